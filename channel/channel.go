@@ -0,0 +1,117 @@
+package channel
+
+import (
+	"fmt"
+
+	"github.com/lacker/coinkit/data"
+	"github.com/lacker/coinkit/util"
+)
+
+// Sign creates an update that pays the recipient of a channel this much in
+// total. It must be signed with the sender's key.
+func Sign(kp *util.KeyPair, channelID uint64, paid uint64) *data.ChannelUpdate {
+	u := &data.ChannelUpdate{
+		Channel: channelID,
+		Paid:    paid,
+	}
+	u.Signature = kp.Sign(u.Payload())
+	return u
+}
+
+// Verify returns an error unless the update is a valid one for the channel.
+func Verify(ch *data.Channel, u *data.ChannelUpdate) error {
+	if u == nil {
+		return fmt.Errorf("nil update")
+	}
+	return ch.CheckUpdate(u)
+}
+
+// A Sender pays through a channel by creating updates.
+// A Sender is not threadsafe.
+type Sender struct {
+	keyPair *util.KeyPair
+	channel *data.Channel
+	paid    uint64
+}
+
+// NewSender returns an error if the key pair is not the channel's sender.
+func NewSender(kp *util.KeyPair, ch *data.Channel) (*Sender, error) {
+	if kp.PublicKey().String() != ch.Sender {
+		return nil, fmt.Errorf("%s is not the sender for channel %d",
+			util.Shorten(kp.PublicKey().String()), ch.ID)
+	}
+	return &Sender{
+		keyPair: kp,
+		channel: ch,
+	}, nil
+}
+
+// Pay returns an update to give to the recipient, which pays them this much
+// more than before.
+// It returns an error if the channel does not have enough money left.
+func (s *Sender) Pay(amount uint64) (*data.ChannelUpdate, error) {
+	if amount > s.channel.Amount-s.paid {
+		return nil, fmt.Errorf("channel %d only has %d left", s.channel.ID,
+			s.channel.Amount-s.paid)
+	}
+	s.paid += amount
+	return Sign(s.keyPair, s.channel.ID, s.paid), nil
+}
+
+// Paid returns how much the sender has paid in total.
+func (s *Sender) Paid() uint64 {
+	return s.paid
+}
+
+// A Receiver checks the updates that it gets through a channel, and keeps
+// the latest one, which is all it needs to close the channel.
+// A Receiver is not threadsafe.
+type Receiver struct {
+	channel *data.Channel
+	latest  *data.ChannelUpdate
+}
+
+func NewReceiver(ch *data.Channel) *Receiver {
+	return &Receiver{channel: ch}
+}
+
+// Receive returns how much more this update pays than the previous one.
+// It returns an error if the update is invalid or pays less.
+func (r *Receiver) Receive(u *data.ChannelUpdate) (uint64, error) {
+	err := Verify(r.channel, u)
+	if err != nil {
+		return 0, err
+	}
+	received := r.Received()
+	if u.Paid < received {
+		return 0, fmt.Errorf("the update pays %d, but we already have %d", u.Paid, received)
+	}
+	r.latest = u
+	return u.Paid - received, nil
+}
+
+// Received returns how much the sender has paid in total.
+func (r *Receiver) Received() uint64 {
+	if r.latest == nil {
+		return 0
+	}
+	return r.latest.Paid
+}
+
+// Latest returns the update to close the channel with.
+// It is nil if nothing has been received.
+func (r *Receiver) Latest() *data.ChannelUpdate {
+	return r.latest
+}
+
+// Close creates the operation for the recipient to close the channel and
+// collect what it was paid. It still has to be signed.
+func (r *Receiver) Close(sequence uint32, fee uint64) *data.CloseChannelOperation {
+	return &data.CloseChannelOperation{
+		Signer:   r.channel.Recipient,
+		Sequence: sequence,
+		Fee:      fee,
+		ID:       r.channel.ID,
+		Update:   r.latest,
+	}
+}
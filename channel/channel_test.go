@@ -0,0 +1,54 @@
+package channel
+
+import (
+	"testing"
+
+	"github.com/lacker/coinkit/data"
+	"github.com/lacker/coinkit/util"
+)
+
+func TestSenderAndReceiver(t *testing.T) {
+	alice := util.NewKeyPairFromSecretPhrase("alice")
+	bob := util.NewKeyPairFromSecretPhrase("bob")
+	ch := &data.Channel{
+		ID:            3,
+		Sender:        alice.PublicKey().String(),
+		Recipient:     bob.PublicKey().String(),
+		Amount:        100,
+		DisputeWindow: 10,
+	}
+	if _, err := NewSender(bob, ch); err == nil {
+		t.Fatalf("only the channel's sender should be able to send")
+	}
+	s, err := NewSender(alice, ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReceiver(ch)
+
+	first, err := s.Pay(30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Pay(50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Pay(21); err == nil {
+		t.Fatalf("the channel should not have enough left")
+	}
+
+	amount, err := r.Receive(second)
+	if err != nil || amount != 80 {
+		t.Fatalf("expected to receive 80, got %d, %s", amount, err)
+	}
+	if _, err := r.Receive(first); err == nil {
+		t.Fatalf("an older update should be rejected")
+	}
+	if _, err := r.Receive(Sign(bob, 3, 100)); err == nil {
+		t.Fatalf("an update not signed by the sender should be rejected")
+	}
+	if r.Received() != 80 || r.Close(1, 0).Update != second {
+		t.Fatalf("the receiver should close with the latest update")
+	}
+}
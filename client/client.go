@@ -0,0 +1,432 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lacker/coinkit/data"
+	"github.com/lacker/coinkit/network"
+	"github.com/lacker/coinkit/util"
+)
+
+// A Client makes requests to the servers of a network on behalf of a user.
+// Each request uses its own connection, so the response to a request can
+// never be confused with the response to another one.
+// When a server cannot be reached, or is too busy, the Client fails over
+// to the next server.
+// A Client is threadsafe.
+type Client struct {
+	addresses []*network.Address
+
+	// The network config, which is needed for quorum queries.
+	// It is nil when the client was only given addresses.
+	config *network.Config
+
+	// Anonymous queries are signed with this key
+	keyPair *util.KeyPair
+
+	// The index of the server we will try first on the next request
+	next  int
+	mutex sync.Mutex
+
+	// How many attempts a single request gets, across all servers
+	MaxAttempts int
+
+	// How long a single attempt can take, when the context has no
+	// earlier deadline
+	AttemptTimeout time.Duration
+}
+
+// ServerError is returned when a server responds to a request with an error.
+// Failing over to another server would not help.
+type ServerError struct {
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server error: %s", e.Message)
+}
+
+// RejectedError is returned when an operation will never be finalized.
+type RejectedError struct {
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("the operation was rejected: %s", e.Reason)
+}
+
+// NewClient creates a client for the servers in a network config.
+func NewClient(config *network.Config) (*Client, error) {
+	addresses := []*network.Address{}
+	for _, address := range config.Servers {
+		addresses = append(addresses, address)
+	}
+	c, err := NewClientWithAddresses(addresses...)
+	if err != nil {
+		return nil, err
+	}
+	c.config = config
+	return c, nil
+}
+
+// NewClientWithAddresses creates a client for a list of servers.
+// The servers are tried in the order provided.
+func NewClientWithAddresses(addresses ...*network.Address) (*Client, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("a client needs at least one server address")
+	}
+	return &Client{
+		addresses:      addresses,
+		keyPair:        util.NewKeyPair(),
+		MaxAttempts:    3 * len(addresses),
+		AttemptTimeout: 5 * time.Second,
+	}, nil
+}
+
+// nextAddress returns the server to try next, and moves on so that the
+// following call returns a different one.
+func (c *Client) nextAddress() *network.Address {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	address := c.addresses[c.next]
+	c.next = (c.next + 1) % len(c.addresses)
+	return address
+}
+
+// stay makes the client keep using a server that worked.
+func (c *Client) stay(address *network.Address) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i, a := range c.addresses {
+		if a == address {
+			c.next = i
+		}
+	}
+}
+
+// sleep waits for the duration, or returns the context's error if it is
+// done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// contextError is like ctx.Err, but it also reports a deadline that has
+// passed. A connection deadline can fire a moment before the context's own
+// timer does.
+func contextError(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// Request signs a message with the client's anonymous key and returns the
+// response from the first server that handles it.
+func (c *Client) Request(ctx context.Context, m util.Message) (util.Message, error) {
+	return c.SignedRequest(ctx, util.NewSignedMessage(m, c.keyPair))
+}
+
+// SignedRequest sends a signed message and returns the response from the first
+// server that handles it.
+// Busy servers are retried after the delay they ask for.
+// A nil response means the server had nothing to say.
+func (c *Client) SignedRequest(ctx context.Context, sm *util.SignedMessage) (util.Message, error) {
+	var lastErr error
+	for attempt := 0; attempt < c.MaxAttempts; attempt++ {
+		if err := contextError(ctx); err != nil {
+			return nil, err
+		}
+		address := c.nextAddress()
+		signed, err := c.attempt(ctx, address, sm)
+		if err != nil {
+			// Failing because the context is done is not worth retrying
+			if ctxErr := contextError(ctx); ctxErr != nil {
+				return nil, ctxErr
+			}
+			lastErr = err
+			continue
+		}
+		var response util.Message
+		if signed != nil {
+			response = signed.Message()
+		}
+		em, ok := response.(*util.ErrorMessage)
+		if ok && em.IsBusy() {
+			lastErr = &ServerError{Message: em.Error}
+			err = sleep(ctx, time.Duration(em.RetryAfter)*time.Millisecond)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		c.stay(address)
+		if ok {
+			return nil, &ServerError{Message: em.Error}
+		}
+		return response, nil
+	}
+	return nil, fmt.Errorf("request failed after %d attempts: %s", c.MaxAttempts, lastErr)
+}
+
+// attempt sends a message to a single server over a new connection, and
+// waits for the response. A nil response means the server had nothing to say.
+func (c *Client) attempt(ctx context.Context, address *network.Address,
+	sm *util.SignedMessage) (*util.SignedMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.AttemptTimeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", address.String())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	// Closing the connection interrupts any read in progress
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	id := newRequestID()
+	sm.WithRequestID(id).Write(conn)
+	reader := bufio.NewReader(conn)
+	for {
+		response, err := util.ReadSignedMessage(reader)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		if response.RequestID() != id {
+			// This is a plain keepalive, or not meant for us
+			continue
+		}
+		if response.IsKeepAlive() {
+			// The server has no response for us
+			return nil, nil
+		}
+		return response, nil
+	}
+}
+
+func newRequestID() string {
+	bs := make([]byte, 8)
+	rand.Read(bs)
+	return hex.EncodeToString(bs)
+}
+
+// query sends a query and expects a data message in response.
+func (c *Client) query(ctx context.Context, q *data.QueryMessage) (*data.DataMessage, error) {
+	response, err := c.Request(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	dm, ok := response.(*data.DataMessage)
+	if !ok || dm == nil {
+		return nil, fmt.Errorf("expected a data message but got: %+v", response)
+	}
+	return dm, nil
+}
+
+// GetAccount returns nil if there is no such account.
+func (c *Client) GetAccount(ctx context.Context, owner string) (*data.Account, error) {
+	dm, err := c.query(ctx, &data.QueryMessage{Account: owner})
+	if err != nil {
+		return nil, err
+	}
+	return dm.Accounts[owner], nil
+}
+
+// GetClaimableBalances returns the claimable balances that an account either
+// locked up or can claim.
+func (c *Client) GetClaimableBalances(ctx context.Context, owner string) ([]*data.ClaimableBalance, error) {
+	dm, err := c.query(ctx, &data.QueryMessage{Account: owner})
+	if err != nil {
+		return nil, err
+	}
+	return dm.ClaimableBalances, nil
+}
+
+// GetTrustlines returns the trustlines an account holds.
+func (c *Client) GetTrustlines(ctx context.Context, owner string) ([]*data.Trustline, error) {
+	dm, err := c.query(ctx, &data.QueryMessage{Account: owner})
+	if err != nil {
+		return nil, err
+	}
+	return dm.Trustlines, nil
+}
+
+// GetBlock returns nil if the block has not been finalized.
+func (c *Client) GetBlock(ctx context.Context, slot int) (*data.Block, error) {
+	dm, err := c.query(ctx, &data.QueryMessage{Block: slot})
+	if err != nil {
+		return nil, err
+	}
+	return dm.Blocks[slot], nil
+}
+
+// GetOperation returns nil if no operation with this signature has been finalized.
+func (c *Client) GetOperation(ctx context.Context, signature string) (*data.SignedOperation, error) {
+	dm, err := c.query(ctx, &data.QueryMessage{Signature: signature})
+	if err != nil {
+		return nil, err
+	}
+	return dm.Operations[signature], nil
+}
+
+// GetBaseFee returns the lowest fee an operation can have right now.
+func (c *Client) GetBaseFee(ctx context.Context) (uint64, error) {
+	dm, err := c.query(ctx, &data.QueryMessage{Fees: true})
+	if err != nil {
+		return 0, err
+	}
+	return dm.BaseFee, nil
+}
+
+// GetStatus returns what the server knows about an operation, which need not
+// be finalized.
+func (c *Client) GetStatus(ctx context.Context, signature string) (*data.OperationStatus, error) {
+	dm, err := c.query(ctx, &data.QueryMessage{Status: signature})
+	if err != nil {
+		return nil, err
+	}
+	// The server always has a status, even if it is just unknown
+	return dm.Statuses[signature], nil
+}
+
+// GetPending returns operations that are waiting to be finalized, along with
+// statistics about the server's operation queue.
+func (c *Client) GetPending(ctx context.Context, q *data.PendingQuery) ([]*data.SignedOperation,
+	*data.QueueStats, error) {
+	dm, err := c.query(ctx, &data.QueryMessage{Pending: q})
+	if err != nil {
+		return nil, nil, err
+	}
+	return dm.Pending, dm.QueueStats, nil
+}
+
+func (c *Client) GetDocuments(ctx context.Context, q *data.DocumentQuery) ([]*data.Document, error) {
+	dm, err := c.query(ctx, &data.QueryMessage{Documents: q})
+	if err != nil {
+		return nil, err
+	}
+	return dm.Documents, nil
+}
+
+func (c *Client) GetBuckets(ctx context.Context, q *data.BucketQuery) ([]*data.Bucket, error) {
+	dm, err := c.query(ctx, &data.QueryMessage{Buckets: q})
+	if err != nil {
+		return nil, err
+	}
+	return dm.Buckets, nil
+}
+
+func (c *Client) GetProviders(ctx context.Context, q *data.ProviderQuery) ([]*data.Provider, error) {
+	dm, err := c.query(ctx, &data.QueryMessage{Providers: q})
+	if err != nil {
+		return nil, err
+	}
+	return dm.Providers, nil
+}
+
+// GetPayments returns the payments an account has received, most recent first.
+func (c *Client) GetPayments(ctx context.Context, q *data.PaymentQuery) ([]*data.PaymentRecord, error) {
+	dm, err := c.query(ctx, &data.QueryMessage{Payments: q})
+	if err != nil {
+		return nil, err
+	}
+	return dm.Payments, nil
+}
+
+// Simulate asks a server what operations would do if they were processed in
+// order, without submitting them. There is one result per operation.
+func (c *Client) Simulate(ctx context.Context, ops ...*data.SignedOperation) ([]*data.SimulationResult, error) {
+	response, err := c.Request(ctx, &data.SimulateMessage{Operations: ops})
+	if err != nil {
+		return nil, err
+	}
+	sm, ok := response.(*data.SimulationMessage)
+	if !ok || sm == nil {
+		return nil, fmt.Errorf("expected a simulation message but got: %+v", response)
+	}
+	return sm.Results, nil
+}
+
+// Submit sends an operation to the network and waits until it is finalized.
+// If the server does not accept the operation, Submit returns a ServerError.
+// If the operation is accepted but the server reports that it left the queue
+// without being finalized, Submit returns a RejectedError.
+func (c *Client) Submit(ctx context.Context, op *data.SignedOperation) error {
+	_, err := c.Request(ctx, data.NewOperationMessage(op))
+	if err != nil {
+		return err
+	}
+	return c.Await(ctx, op)
+}
+
+// Await waits until an operation that was already submitted is finalized.
+// The server tells us as soon as it happens, so this does not poll.
+// If the server reports that the operation was rejected, Await returns a
+// RejectedError. Other errors from the server are returned as they are.
+func (c *Client) Await(ctx context.Context, op *data.SignedOperation) error {
+	for {
+		// The server must respond before our attempt times out
+		timeout := c.AttemptTimeout / 2
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+			timeout = time.Until(deadline)
+		}
+		if timeout < time.Millisecond {
+			timeout = time.Millisecond
+		}
+		response, err := c.Request(ctx, &data.AwaitMessage{
+			Signature: op.Signature,
+			Account:   op.GetSigner(),
+			Sequence:  op.GetSequence(),
+			Timeout:   int(timeout / time.Millisecond),
+		})
+		if err != nil {
+			return err
+		}
+		dm, ok := response.(*data.DataMessage)
+		if !ok || dm == nil {
+			return fmt.Errorf("expected a data message but got: %+v", response)
+		}
+		if dm.Operations[op.Signature] != nil {
+			return nil
+		}
+		if status := dm.Statuses[op.Signature]; status != nil && status.IsRejected() {
+			reason := status.State
+			if status.Error != "" {
+				reason = status.Error
+			}
+			return &RejectedError{Reason: reason}
+		}
+	}
+}
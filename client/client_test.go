@@ -0,0 +1,228 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lacker/coinkit/data"
+	"github.com/lacker/coinkit/network"
+	"github.com/lacker/coinkit/util"
+)
+
+// fakeServer answers every message it receives with handle, where a nil
+// response means a keepalive.
+// It returns the address it is listening on.
+func fakeServer(t *testing.T, handle func(*util.SignedMessage) util.Message) *network.Address {
+	return fakeSignedServer(t, util.NewKeyPairFromSecretPhrase("fake server"), handle)
+}
+
+// fakeSignedServer is like fakeServer, but it signs its responses with kp.
+func fakeSignedServer(t *testing.T, kp *util.KeyPair,
+	handle func(*util.SignedMessage) util.Message) *network.Address {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sm, err := util.ReadSignedMessage(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				response := util.KeepAlive()
+				if m := handle(sm); m != nil {
+					response = util.NewSignedMessage(m, kp)
+				}
+				response.WithRequestID(sm.RequestID()).Write(conn)
+			}()
+		}
+	}()
+	return &network.Address{
+		Host: "127.0.0.1",
+		Port: ln.Addr().(*net.TCPAddr).Port,
+	}
+}
+
+// deadAddress returns an address where nothing is listening.
+func deadAddress(t *testing.T) *network.Address {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return &network.Address{Host: "127.0.0.1", Port: port}
+}
+
+func accountServer(t *testing.T) *network.Address {
+	return fakeServer(t, func(sm *util.SignedMessage) util.Message {
+		q := sm.Message().(*data.QueryMessage)
+		return &data.DataMessage{
+			I: 1,
+			Accounts: map[string]*data.Account{
+				q.Account: &data.Account{Owner: q.Account, Balance: 7},
+			},
+		}
+	})
+}
+
+// newTestClient creates a client for the test servers.
+func newTestClient(t *testing.T, addresses ...*network.Address) *Client {
+	c, err := NewClientWithAddresses(addresses...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestNoAddresses(t *testing.T) {
+	if _, err := NewClientWithAddresses(); err == nil {
+		t.Fatalf("a client with no servers should be an error")
+	}
+}
+
+func TestFailover(t *testing.T) {
+	c := newTestClient(t, deadAddress(t), accountServer(t))
+	account, err := c.GetAccount(context.Background(), "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Balance != 7 {
+		t.Fatalf("unexpected account: %+v", account)
+	}
+}
+
+func TestRetryWhenBusy(t *testing.T) {
+	busy := fakeServer(t, func(sm *util.SignedMessage) util.Message {
+		return &util.ErrorMessage{Error: "busy", RetryAfter: 1}
+	})
+	c := newTestClient(t, busy, accountServer(t))
+	account, err := c.GetAccount(context.Background(), "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Balance != 7 {
+		t.Fatalf("unexpected account: %+v", account)
+	}
+}
+
+func TestServerErrorsAreNotRetried(t *testing.T) {
+	attempts := 0
+	bad := fakeServer(t, func(sm *util.SignedMessage) util.Message {
+		attempts++
+		return &util.ErrorMessage{Error: "bad query"}
+	})
+	c := newTestClient(t, bad)
+	_, err := c.GetAccount(context.Background(), "bob")
+	if _, ok := err.(*ServerError); !ok {
+		t.Fatalf("expected a server error but got %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected one attempt but got %d", attempts)
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	slow := fakeServer(t, func(sm *util.SignedMessage) util.Message {
+		time.Sleep(time.Second)
+		return &data.DataMessage{}
+	})
+	c := newTestClient(t, slow)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.GetAccount(ctx, "bob")
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected a deadline error but got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("the deadline was not respected")
+	}
+
+	// Servers that cannot be reached should not hide the deadline either
+	c = newTestClient(t, deadAddress(t))
+	c.MaxAttempts = 1000000
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c.GetAccount(ctx, "bob")
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected a deadline error but got %v", err)
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	kp := util.NewKeyPairFromSecretPhrase("alice")
+	op := data.NewSignedOperation(&data.SendOperation{
+		Signer:   kp.PublicKey().String(),
+		Sequence: 1,
+		To:       util.NewKeyPairFromSecretPhrase("bob").PublicKey().String(),
+		Amount:   10,
+		Fee:      1,
+	}, kp)
+	awaits := 0
+	server := fakeServer(t, func(sm *util.SignedMessage) util.Message {
+		switch sm.Message().(type) {
+		case *data.OperationMessage:
+			return nil
+		case *data.AwaitMessage:
+			awaits++
+			if awaits < 3 {
+				// The await timed out
+				return &data.DataMessage{}
+			}
+			return &data.DataMessage{
+				Operations: map[string]*data.SignedOperation{op.Signature: op},
+			}
+		}
+		return &util.ErrorMessage{Error: "unexpected message"}
+	})
+	c := newTestClient(t, server)
+	err := c.Submit(context.Background(), op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if awaits != 3 {
+		t.Fatalf("expected 3 awaits but got %d", awaits)
+	}
+
+	expiring := fakeServer(t, func(sm *util.SignedMessage) util.Message {
+		if _, ok := sm.Message().(*data.AwaitMessage); ok {
+			return &data.DataMessage{
+				Statuses: map[string]*data.OperationStatus{
+					op.Signature: &data.OperationStatus{
+						Signature: op.Signature,
+						State:     data.StatusExpired,
+					},
+				},
+			}
+		}
+		return nil
+	})
+	c = newTestClient(t, expiring)
+	err = c.Submit(context.Background(), op)
+	if _, ok := err.(*RejectedError); !ok {
+		t.Fatalf("expected a rejection but got %v", err)
+	}
+
+	// A server that cannot handle the await has not rejected anything
+	failing := fakeServer(t, func(sm *util.SignedMessage) util.Message {
+		if _, ok := sm.Message().(*data.AwaitMessage); ok {
+			return &util.ErrorMessage{Error: "no database"}
+		}
+		return nil
+	})
+	c = newTestClient(t, failing)
+	err = c.Submit(context.Background(), op)
+	if _, ok := err.(*ServerError); !ok {
+		t.Fatalf("expected a server error but got %v", err)
+	}
+}
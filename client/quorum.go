@@ -0,0 +1,195 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lacker/coinkit/consensus"
+	"github.com/lacker/coinkit/data"
+	"github.com/lacker/coinkit/network"
+	"github.com/lacker/coinkit/util"
+)
+
+// How many times a quorum query asks every server before giving up
+const quorumRounds = 3
+
+// How long we give lagging servers to catch up before asking again
+const quorumRetryDelay = 500 * time.Millisecond
+
+// A DivergenceError is returned by a quorum query when servers sign different
+// data for the same slot, even if enough of them agree to outvote the rest.
+// The signed responses are evidence that some servers are faulty.
+type DivergenceError struct {
+	Slot      int
+	Responses []*util.SignedMessage
+}
+
+func (e *DivergenceError) Error() string {
+	signers := []string{}
+	for _, sm := range e.Responses {
+		signers = append(signers, util.Shorten(sm.Signer()))
+	}
+	return fmt.Sprintf("servers signed conflicting data for slot %d: %s",
+		e.Slot, strings.Join(signers, ", "))
+}
+
+// quorumFinder lets us judge a set of servers with consensus.MeetsQuorum.
+// Every server is expected to use the quorum slice from the network config,
+// and we look at the set from the point of view of one of its members.
+type quorumFinder struct {
+	slice *consensus.QuorumSlice
+	us    util.PublicKey
+}
+
+func (f *quorumFinder) QuorumSlice(node string) (*consensus.QuorumSlice, bool) {
+	return f.slice, true
+}
+
+func (f *quorumFinder) PublicKey() util.PublicKey {
+	return f.us
+}
+
+// meetsQuorum returns whether these servers are enough to trust what they
+// agree on.
+func meetsQuorum(slice *consensus.QuorumSlice, nodes []string) bool {
+	for _, node := range nodes {
+		pk, err := util.ReadPublicKey(node)
+		if err != nil {
+			continue
+		}
+		if consensus.MeetsQuorum(&quorumFinder{slice: slice, us: pk}, nodes) {
+			return true
+		}
+	}
+	return false
+}
+
+// agree looks for data that a quorum of servers signed for the same slot.
+// If any servers signed conflicting data for a slot, it also returns a
+// DivergenceError, whether or not there is a quorum.
+// It returns nil, nil when there is no quorum but also no conflict, which
+// typically means the servers are on different slots.
+// Responses that are not data messages are ignored.
+func agree(slice *consensus.QuorumSlice, responses []*util.SignedMessage) (*data.DataMessage, error) {
+	// Group the responses by the data they contain, which includes the slot
+	groups := make(map[string][]*util.SignedMessage)
+	keys := []string{}
+	seen := make(map[string]bool)
+	for _, sm := range responses {
+		dm, ok := sm.Message().(*data.DataMessage)
+		if !ok || dm == nil || seen[sm.Signer()] {
+			continue
+		}
+		seen[sm.Signer()] = true
+		key := string(util.CanonicalJSONEncode(dm))
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], sm)
+	}
+
+	var answer *data.DataMessage
+	keysForSlot := make(map[int][]string)
+	for _, key := range keys {
+		group := groups[key]
+		signers := []string{}
+		for _, sm := range group {
+			signers = append(signers, sm.Signer())
+		}
+		dm := group[0].Message().(*data.DataMessage)
+		if answer == nil && meetsQuorum(slice, signers) {
+			answer = dm
+		}
+		keysForSlot[dm.I] = append(keysForSlot[dm.I], key)
+	}
+
+	slots := []int{}
+	for slot, _ := range keysForSlot {
+		slots = append(slots, slot)
+	}
+	sort.Ints(slots)
+	for _, slot := range slots {
+		if len(keysForSlot[slot]) < 2 {
+			continue
+		}
+		evidence := []*util.SignedMessage{}
+		for _, key := range keysForSlot[slot] {
+			evidence = append(evidence, groups[key]...)
+		}
+		return answer, &DivergenceError{Slot: slot, Responses: evidence}
+	}
+	return answer, nil
+}
+
+// QuorumQuery sends a query to every server in the network config, and only
+// returns data that a quorum of them signed for the same slot. This way the
+// answer can be trusted even if some servers are faulty.
+// If servers sign conflicting data for a slot, QuorumQuery returns a
+// DivergenceError, along with the data a quorum agreed on if there is any.
+func (c *Client) QuorumQuery(ctx context.Context, q *data.QueryMessage) (*data.DataMessage, error) {
+	if c.config == nil {
+		return nil, errors.New("a quorum query needs a client created with a network config")
+	}
+	slice := c.config.QuorumSlice()
+	sm := util.NewSignedMessage(q, c.keyPair)
+	for round := 0; round < quorumRounds; round++ {
+		if round > 0 {
+			err := sleep(ctx, quorumRetryDelay)
+			if err != nil {
+				return nil, err
+			}
+		}
+		dm, err := c.askAll(ctx, slice, sm)
+		if err != nil || dm != nil {
+			return dm, err
+		}
+	}
+	return nil, fmt.Errorf("no quorum of servers agreed after %d rounds", quorumRounds)
+}
+
+// askAll sends a message to every server at once, and waits for all of them
+// to respond, so that a server that signs conflicting data is caught even if
+// it answers last. Each attempt is limited by AttemptTimeout, so one
+// unresponsive server cannot hold up the round forever.
+func (c *Client) askAll(ctx context.Context, slice *consensus.QuorumSlice,
+	sm *util.SignedMessage) (*data.DataMessage, error) {
+	// Buffered, so that stragglers don't block after we return
+	responses := make(chan *util.SignedMessage, len(c.config.Servers))
+	for key, address := range c.config.Servers {
+		go func(key string, address *network.Address) {
+			response, err := c.attempt(ctx, address, sm)
+			if err != nil || response == nil || response.Signer() != key {
+				responses <- nil
+				return
+			}
+			responses <- response
+		}(key, address)
+	}
+
+	received := []*util.SignedMessage{}
+	for i := 0; i < len(c.config.Servers); i++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case response := <-responses:
+			if response == nil {
+				continue
+			}
+			received = append(received, response)
+		}
+	}
+	return agree(slice, received)
+}
+
+// QuorumGetAccount is like GetAccount, but it uses a quorum query.
+func (c *Client) QuorumGetAccount(ctx context.Context, owner string) (*data.Account, error) {
+	dm, err := c.QuorumQuery(ctx, &data.QueryMessage{Account: owner})
+	if err != nil {
+		return nil, err
+	}
+	return dm.Accounts[owner], nil
+}
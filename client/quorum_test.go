@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lacker/coinkit/consensus"
+	"github.com/lacker/coinkit/data"
+	"github.com/lacker/coinkit/network"
+	"github.com/lacker/coinkit/util"
+)
+
+func TestAgree(t *testing.T) {
+	kps := []*util.KeyPair{}
+	members := []string{}
+	for i := 0; i < 4; i++ {
+		kp := util.NewKeyPairFromSecretPhrase(fmt.Sprintf("server %d", i))
+		kps = append(kps, kp)
+		members = append(members, kp.PublicKey().String())
+	}
+	slice := consensus.NewQuorumSlice(members, 3)
+
+	balance := func(slot int, amount uint64) *data.DataMessage {
+		return &data.DataMessage{
+			I:        slot,
+			Accounts: map[string]*data.Account{"bob": &data.Account{Balance: amount}},
+		}
+	}
+	sign := func(i int, dm *data.DataMessage) *util.SignedMessage {
+		return util.NewSignedMessage(dm, kps[i])
+	}
+
+	// Two servers are not enough
+	responses := []*util.SignedMessage{sign(0, balance(5, 10)), sign(1, balance(5, 10))}
+	dm, err := agree(slice, responses)
+	if dm != nil || err != nil {
+		t.Fatalf("two servers should not be a quorum")
+	}
+
+	// A server on a different slot is not a conflict
+	responses = append(responses, sign(2, balance(6, 20)))
+	dm, err = agree(slice, responses)
+	if dm != nil || err != nil {
+		t.Fatalf("expected no answer and no error")
+	}
+
+	// The same server answering twice does not count twice
+	dm, err = agree(slice, append(responses, sign(1, balance(5, 10))))
+	if dm != nil || err != nil {
+		t.Fatalf("a duplicate signer should not make a quorum")
+	}
+
+	// Three servers are a quorum
+	dm, err = agree(slice, []*util.SignedMessage{
+		sign(0, balance(5, 10)), sign(2, balance(5, 10)), sign(3, balance(5, 10)),
+	})
+	if err != nil || dm == nil || dm.Accounts["bob"].Balance != 10 {
+		t.Fatalf("expected three servers to agree, got %+v %v", dm, err)
+	}
+
+	// A liar still gets caught when the rest make a quorum
+	dm, err = agree(slice, []*util.SignedMessage{
+		sign(0, balance(5, 10)), sign(1, balance(5, 99)),
+		sign(2, balance(5, 10)), sign(3, balance(5, 10)),
+	})
+	if dm == nil || dm.Accounts["bob"].Balance != 10 {
+		t.Fatalf("expected three servers to agree, got %+v", dm)
+	}
+	de, ok := err.(*DivergenceError)
+	if !ok || de.Slot != 5 || len(de.Responses) != 4 {
+		t.Fatalf("expected a divergence alongside the quorum but got %v", err)
+	}
+
+	// Conflicting data for a slot without a quorum is a divergence
+	dm, err = agree(slice, []*util.SignedMessage{
+		sign(0, balance(5, 10)), sign(1, balance(5, 99)), sign(2, balance(5, 10)),
+	})
+	de, ok = err.(*DivergenceError)
+	if dm != nil || !ok {
+		t.Fatalf("expected a divergence but got %+v %v", dm, err)
+	}
+	if de.Slot != 5 || len(de.Responses) != 3 {
+		t.Fatalf("bad divergence evidence: %+v", de)
+	}
+}
+
+func TestQuorumQueryCatchesLateDivergence(t *testing.T) {
+	config := &network.Config{
+		Servers:   make(map[string]*network.Address),
+		Threshold: 3,
+	}
+	for i := 0; i < 4; i++ {
+		kp := util.NewKeyPairFromSecretPhrase(fmt.Sprintf("server %d", i))
+		balance := uint64(10)
+		delay := time.Duration(0)
+		if i == 3 {
+			// The liar answers after the others already make a quorum
+			balance = 99
+			delay = 200 * time.Millisecond
+		}
+		config.Servers[kp.PublicKey().String()] = fakeSignedServer(t, kp,
+			func(sm *util.SignedMessage) util.Message {
+				time.Sleep(delay)
+				return &data.DataMessage{
+					I:        5,
+					Accounts: map[string]*data.Account{"bob": &data.Account{Balance: balance}},
+				}
+			})
+	}
+	c, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm, err := c.QuorumQuery(context.Background(), &data.QueryMessage{Account: "bob"})
+	if dm == nil || dm.Accounts["bob"].Balance != 10 {
+		t.Fatalf("expected the quorum's data but got %+v", dm)
+	}
+	de, ok := err.(*DivergenceError)
+	if !ok || len(de.Responses) != 4 {
+		t.Fatalf("expected a divergence with every response but got %v", err)
+	}
+}
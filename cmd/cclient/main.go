@@ -2,12 +2,15 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"encoding/csv"
 	"os"
 	"strconv"
 
 	"github.com/davecgh/go-spew/spew"
 
 	"fmt"
+	"github.com/lacker/coinkit/client"
 	"github.com/lacker/coinkit/data"
 	"github.com/lacker/coinkit/network"
 	"github.com/lacker/coinkit/util"
@@ -63,7 +66,8 @@ func login() *util.KeyPair {
 	return kp
 }
 
-func send(recipient string, amountStr string) {
+// memoStr is empty when there is no memo.
+func send(recipient string, amountStr string, memoStr string) {
 	amountInt, err := strconv.Atoi(amountStr)
 	if err != nil {
 		util.Logger.Fatalf("could not convert %s to a number", amountStr)
@@ -71,6 +75,13 @@ func send(recipient string, amountStr string) {
 	if _, err := util.ReadPublicKey(recipient); err != nil {
 		util.Logger.Fatalf("invalid address: %s", recipient)
 	}
+	var memo *data.Memo
+	if memoStr != "" {
+		memo, err = data.ParseMemo(memoStr)
+		if err != nil {
+			util.Logger.Fatal(err)
+		}
+	}
 	amount := uint64(amountInt)
 	kp := login()
 	user := kp.PublicKey().String()
@@ -84,24 +95,123 @@ func send(recipient string, amountStr string) {
 			amount, account.Balance)
 	}
 
+	// Pay the base fee, which is the least we can pay
+	c, err := client.NewClient(network.NewLocalNetworkConfig())
+	if err != nil {
+		util.Logger.Fatal(err)
+	}
+	fee, err := c.GetBaseFee(context.Background())
+	if err != nil {
+		util.Logger.Fatal(err)
+	}
+	if account.Balance < amount+fee {
+		util.Logger.Fatalf("cannot send %d with a fee of %d when our account only has %d",
+			amount, fee, account.Balance)
+	}
+
 	seq := account.Sequence + 1
 	op := &data.SendOperation{
 		Signer:   user,
 		Sequence: seq,
 		To:       recipient,
 		Amount:   amount,
-		Fee:      0,
+		Fee:      fee,
+		Memo:     memo,
 	}
 
-	// Send our operation to the network
+	// Send our operation to the network, and wait for it to clear
 	sop := data.NewSignedOperation(op, kp)
-	om := data.NewOperationMessage(sop)
-	sm := util.NewSignedMessage(om, kp)
-	conn.Send(sm)
-	util.Logger.Printf("sending %d to %s", amount, recipient)
+	util.Logger.Printf("sending %d to %s with a fee of %d", amount, recipient, fee)
+	err = c.Submit(context.Background(), sop)
+	if err != nil {
+		util.Logger.Fatal(err)
+	}
+	util.Logger.Printf("op %d cleared", op.GetSequence())
+}
+
+// Reads payments from a csv file with lines of recipient,amount[,memo].
+func readPayments(filename string) []*data.Payment {
+	file, err := os.Open(filename)
+	if err != nil {
+		util.Logger.Fatal(err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		util.Logger.Fatal(err)
+	}
+
+	payments := []*data.Payment{}
+	for i, record := range records {
+		if len(record) < 2 || len(record) > 3 {
+			util.Logger.Fatalf("line %d should be recipient,amount[,memo]", i+1)
+		}
+		if _, err := util.ReadPublicKey(record[0]); err != nil {
+			util.Logger.Fatalf("invalid address on line %d: %s", i+1, record[0])
+		}
+		amount, err := strconv.ParseUint(record[1], 10, 64)
+		if err != nil {
+			util.Logger.Fatalf("could not convert %s to a number on line %d", record[1], i+1)
+		}
+		p := &data.Payment{
+			To:     record[0],
+			Amount: amount,
+		}
+		if len(record) == 3 && record[2] != "" {
+			p.Memo, err = data.ParseMemo(record[2])
+			if err != nil {
+				util.Logger.Fatalf("bad memo on line %d: %s", i+1, err)
+			}
+		}
+		payments = append(payments, p)
+	}
+	return payments
+}
+
+func multisend(filename string) {
+	payments := readPayments(filename)
+	kp := login()
+	user := kp.PublicKey().String()
+	conn := newConnection()
+	account := network.GetAccount(conn, user)
+
+	util.Logger.Printf("account data for %s:\n%s", user, spew.Sdump(account))
+
+	// Pay the base fee, which is the least we can pay
+	c, err := client.NewClient(network.NewLocalNetworkConfig())
+	if err != nil {
+		util.Logger.Fatal(err)
+	}
+	fee, err := c.GetBaseFee(context.Background())
+	if err != nil {
+		util.Logger.Fatal(err)
+	}
 
-	// Wait for our send operation to clear
-	network.WaitToClear(conn, user, seq)
+	op := &data.MultiSendOperation{
+		Signer:   user,
+		Sequence: account.Sequence + 1,
+		Fee:      fee,
+		Payments: payments,
+	}
+	if err := op.Verify(); err != nil {
+		util.Logger.Fatal(err)
+	}
+	if account.Balance < fee || account.Balance-fee < op.Total() {
+		util.Logger.Fatalf("cannot send %d with a fee of %d when our account only has %d",
+			op.Total(), fee, account.Balance)
+	}
+
+	// Send our operation to the network, and wait for it to clear
+	sop := data.NewSignedOperation(op, kp)
+	util.Logger.Printf("sending %d to %d accounts with a fee of %d",
+		op.Total(), len(payments), fee)
+	err = c.Submit(context.Background(), sop)
+	if err != nil {
+		util.Logger.Fatal(err)
+	}
 	util.Logger.Printf("op %d cleared", op.GetSequence())
 }
 
@@ -119,7 +229,7 @@ func handler(w http.ResponseWriter, r *http.Request) {
 
 func main() {
 	if len(os.Args) < 2 {
-		util.Logger.Fatal("Usage: cclient {generate,proxy,send,status} ...")
+		util.Logger.Fatal("Usage: cclient {generate,multisend,proxy,send,status} ...")
 	}
 	op := os.Args[1]
 	rest := os.Args[2:]
@@ -136,10 +246,20 @@ func main() {
 		}
 
 	case "send":
-		if len(rest) != 2 {
-			util.Logger.Fatal("Usage: cclient send <user> <amount>")
+		if len(rest) != 2 && len(rest) != 3 {
+			util.Logger.Fatal("Usage: cclient send <user> <amount> [memo]")
+		}
+		memo := ""
+		if len(rest) == 3 {
+			memo = rest[2]
+		}
+		send(rest[0], rest[1], memo)
+
+	case "multisend":
+		if len(rest) != 1 {
+			util.Logger.Fatal("Usage: cclient multisend <path/to/payments.csv>")
 		}
-		send(rest[0], rest[1])
+		multisend(rest[0])
 
 	case "generate":
 		if len(rest) != 0 {
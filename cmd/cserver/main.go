@@ -66,6 +66,7 @@ func main() {
 		panic(err)
 	}
 	net := network.NewConfigFromSerialized(bytes)
+	data.FeeActivationSlot = net.FeeActivationSlot
 
 	s := network.NewServer(kp, net, db)
 	if s == nil {
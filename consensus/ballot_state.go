@@ -437,6 +437,9 @@ func (s *BallotState) GoToNextBallot() bool {
 	}
 
 	s.b = b
+	if b.n > 1 {
+		ballotBumps.Inc()
+	}
 	if s.cn == 0 && s.hn >= s.b.n && !s.AcceptedAbort(s.hn, s.b.x) {
 		// With the new ballot, we can immediately vote to commit
 		s.cn = s.b.n
@@ -1,6 +1,8 @@
 package consensus
 
 import (
+	"time"
+
 	"github.com/lacker/coinkit/util"
 )
 
@@ -30,6 +32,9 @@ type Block struct {
 
 	// Who we are
 	publicKey util.PublicKey
+
+	// When we started working on this block
+	start time.Time
 }
 
 func NewBlock(
@@ -43,6 +48,7 @@ func NewBlock(
 		values:    vs,
 		D:         qs,
 		publicKey: publicKey,
+		start:     time.Now(),
 	}
 	return block
 }
@@ -1,6 +1,8 @@
 package consensus
 
 import (
+	"time"
+
 	"github.com/davecgh/go-spew/spew"
 
 	"github.com/lacker/coinkit/util"
@@ -52,7 +54,9 @@ func (c *Chain) Handle(sender string, message util.Message) (util.Message, bool)
 			c.Logf("advancing to slot %d", slot+1)
 			c.values.Finalize(ext.X, ext.Cn, ext.Hn, ext.D)
 			c.history[slot] = ext
+			externalizeSeconds.Observe(time.Since(c.current.start).Seconds())
 			c.current = NewBlock(c.publicKey, c.D, slot+1, c.values)
+			slotGauge.Set(float64(slot + 1))
 		}
 		return nil, false
 	}
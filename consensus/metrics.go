@@ -0,0 +1,21 @@
+package consensus
+
+import (
+	"github.com/lacker/coinkit/util"
+)
+
+var slotGauge = util.NewGauge(
+	"coinkit_consensus_slot", "The slot that consensus is working on.")
+
+var externalizeSeconds = util.NewHistogram(
+	"coinkit_consensus_externalize_seconds",
+	"Time from starting work on a slot until it is externalized.",
+	[]float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 30, 60, 120})
+
+var ballotBumps = util.NewCounter(
+	"coinkit_consensus_ballot_bumps_total",
+	"Times we moved on to a higher ballot number than 1.")
+
+var nominationRounds = util.NewCounter(
+	"coinkit_consensus_nominations_total",
+	"Times this node nominated a new value.")
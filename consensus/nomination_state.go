@@ -92,6 +92,7 @@ func (s *NominationState) MaybeNominateNewValue() bool {
 
 	s.Logf("nominating %s", util.Shorten(string(v)))
 	s.NominateNewValue(v)
+	nominationRounds.Inc()
 	return true
 }
 
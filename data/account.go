@@ -27,6 +27,13 @@ type Account struct {
 	// How much data this account is currently storing.
 	// Storage can never exceed balance.
 	Storage uint64 `json:"storage"`
+
+	// Who controls this account, when it is not just the owner key.
+	// Nil means that the owner key alone authorizes every operation.
+	Auth *AccountAuth `json:"auth,omitempty"`
+
+	// Keys that can act for this account, within a limited scope
+	Delegates DelegateMap `json:"delegates,omitempty"`
 }
 
 // For debugging
@@ -55,14 +62,43 @@ func (a *Account) CheckEqual(other *Account) error {
 		return fmt.Errorf("data mismatch for owner %s: balance %d != balance %d",
 			a.Owner, a.Balance, other.Balance)
 	}
+	if !a.Auth.Equal(other.Auth) {
+		return fmt.Errorf("data mismatch for owner %s: auth %+v != auth %+v",
+			a.Owner, a.Auth, other.Auth)
+	}
+	if !a.Delegates.Equal(other.Delegates) {
+		return fmt.Errorf("data mismatch for owner %s: delegates %s != delegates %s",
+			a.Owner, a.Delegates, other.Delegates)
+	}
 	return nil
 }
 
 func (a *Account) Bytes() []byte {
-	return []byte(fmt.Sprintf("%s:%d:%d", a.Owner, a.Sequence, a.Balance))
+	s := fmt.Sprintf("%s:%d:%d", a.Owner, a.Sequence, a.Balance)
+	if a.Auth != nil {
+		s += fmt.Sprintf(":%s", util.CanonicalJSONEncode(a.Auth))
+	}
+	if len(a.Delegates) > 0 {
+		s += fmt.Sprintf(":delegates:%s", util.CanonicalJSONEncode(a.Delegates))
+	}
+	return []byte(s)
 }
 
 func (a *Account) ValidateSendOperation(op *SendOperation) bool {
 	cost := op.Amount + op.Fee
 	return cost <= a.Balance
 }
+
+// Authorizes returns whether signatures from these keys are enough for the
+// account to authorize an operation in the given category.
+func (a *Account) Authorizes(keys []string, category int) bool {
+	if a.Auth == nil {
+		for _, key := range keys {
+			if key == a.Owner {
+				return true
+			}
+		}
+		return false
+	}
+	return a.Auth.Weight(keys) >= uint64(a.Auth.Threshold(category))
+}
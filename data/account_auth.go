@@ -0,0 +1,145 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// MaxSigners is the most signer keys a single account can have.
+const MaxSigners = 20
+
+// The categories of operation. Each one needs the signers of an operation to
+// meet a different threshold.
+const (
+	AuthLow = iota
+	AuthMedium
+	AuthHigh
+)
+
+// AccountAuth describes who can authorize operations for an account that is
+// controlled by keys other than its own.
+// Each signer key has a weight, and an operation is authorized when the
+// weights of the keys that signed it add up to the threshold for its
+// category.
+// The owner key only counts if it is one of the signers, so leaving it out
+// rotates the account to new keys while keeping its address.
+type AccountAuth struct {
+	// Maps public key to weight
+	Signers map[string]uint32 `json:"signers"`
+
+	Low    uint32 `json:"low"`
+	Medium uint32 `json:"medium"`
+	High   uint32 `json:"high"`
+}
+
+func (a *AccountAuth) String() string {
+	keys := []string{}
+	for key, _ := range a.Signers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := []string{}
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%d", util.Shorten(key), a.Signers[key]))
+	}
+	return fmt.Sprintf("signers=[%s] thresholds=%d/%d/%d",
+		strings.Join(parts, " "), a.Low, a.Medium, a.High)
+}
+
+// Check returns an error if this is not a sensible way to control an account.
+// In particular, the signers must be able to meet the high threshold, or else
+// nobody could ever change the signers again.
+func (a *AccountAuth) Check() error {
+	if len(a.Signers) == 0 {
+		return errors.New("an account needs at least one signer")
+	}
+	if len(a.Signers) > MaxSigners {
+		return fmt.Errorf("an account can have at most %d signers", MaxSigners)
+	}
+	total := uint64(0)
+	for key, weight := range a.Signers {
+		if _, err := util.ReadPublicKey(key); err != nil {
+			return fmt.Errorf("bad signer key %s: %s", key, err)
+		}
+		if weight == 0 {
+			return fmt.Errorf("signer %s has no weight", key)
+		}
+		total += uint64(weight)
+	}
+	if a.Low > a.Medium || a.Medium > a.High {
+		return errors.New("thresholds must be ordered low <= medium <= high")
+	}
+	if a.Low == 0 {
+		return errors.New("thresholds must be positive")
+	}
+	if total < uint64(a.High) {
+		return fmt.Errorf("the signers only have a total weight of %d, so they could "+
+			"never meet the high threshold of %d", total, a.High)
+	}
+	return nil
+}
+
+// Threshold returns how much weight an operation in this category needs.
+func (a *AccountAuth) Threshold(category int) uint32 {
+	switch category {
+	case AuthLow:
+		return a.Low
+	case AuthMedium:
+		return a.Medium
+	default:
+		return a.High
+	}
+}
+
+// Weight returns the total weight of a set of keys.
+func (a *AccountAuth) Weight(keys []string) uint64 {
+	total := uint64(0)
+	for _, key := range keys {
+		total += uint64(a.Signers[key])
+	}
+	return total
+}
+
+func (a *AccountAuth) Equal(other *AccountAuth) bool {
+	if a == nil || other == nil {
+		return a == other
+	}
+	return string(util.CanonicalJSONEncode(a)) == string(util.CanonicalJSONEncode(other))
+}
+
+// A nil AccountAuth is stored as null.
+func (a *AccountAuth) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	bytes := util.CanonicalJSONEncode(a)
+	return driver.Value(bytes), nil
+}
+
+func (a *AccountAuth) Scan(src interface{}) error {
+	bytes, ok := src.([]byte)
+	if !ok {
+		return errors.New("expected []byte")
+	}
+	return json.Unmarshal(bytes, a)
+}
+
+// AuthCategory returns which threshold an operation needs to meet.
+// Changing who controls an account is high, operations that only touch
+// documents are low, and everything else is medium.
+func AuthCategory(op Operation) int {
+	switch op.(type) {
+	case *SetSignersOperation, *DelegateOperation:
+		return AuthHigh
+	case *CreateDocumentOperation, *UpdateDocumentOperation, *DeleteDocumentOperation:
+		return AuthLow
+	default:
+		return AuthMedium
+	}
+}
@@ -0,0 +1,121 @@
+package data
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// MaxAssetCodeLength is the longest code an asset can have.
+const MaxAssetCodeLength = 12
+
+var validAssetCode = regexp.MustCompile("^[A-Z0-9]+$")
+
+// IsValidAssetCode returns whether s can be the code for an asset.
+func IsValidAssetCode(s string) bool {
+	return len(s) <= MaxAssetCodeLength && validAssetCode.MatchString(s)
+}
+
+// AssetKey is how an asset is keyed, since each issuer has its own codes.
+func AssetKey(issuer string, code string) string {
+	return code + ":" + issuer
+}
+
+// An Asset is a currency that an account issues, like storage vouchers or
+// loyalty points. Other accounts hold it through trustlines.
+type Asset struct {
+	// A short name for the asset, like "POINTS"
+	Code string `json:"code"`
+
+	// The account that issued the asset
+	Issuer string `json:"issuer"`
+
+	// When AuthRequired is set, the issuer has to authorize a trustline
+	// before it can hold the asset.
+	AuthRequired bool `json:"authRequired,omitempty"`
+
+	// When Revocable is set, the issuer can revoke a trustline's
+	// authorization, which freezes its balance.
+	Revocable bool `json:"revocable,omitempty"`
+
+	// How much of the asset has been issued and not sent back to the issuer
+	Supply uint64 `json:"supply"`
+}
+
+func (a *Asset) Key() string {
+	return AssetKey(a.Issuer, a.Code)
+}
+
+func (a *Asset) String() string {
+	return fmt.Sprintf("asset %s, issuer:%s, supply:%d",
+		a.Code, util.Shorten(a.Issuer), a.Supply)
+}
+
+func (a *Asset) CheckEqual(other *Asset) error {
+	if a == nil && other == nil {
+		return nil
+	}
+	if a == nil || other == nil || *a != *other {
+		return fmt.Errorf("asset mismatch: %+v != %+v", a, other)
+	}
+	return nil
+}
+
+// TrustlineKey is how a trustline is keyed.
+// Public keys and asset codes have no colons, so this can be split apart.
+func TrustlineKey(owner string, issuer string, code string) string {
+	return owner + ":" + AssetKey(issuer, code)
+}
+
+// parseTrustlineKey returns the owner, issuer, and code for a trustline key.
+func parseTrustlineKey(key string) (string, string, string, error) {
+	parts := strings.Split(key, ":")
+	if len(parts) != 3 {
+		return "", "", "", fmt.Errorf("bad trustline key: %s", key)
+	}
+	return parts[0], parts[2], parts[1], nil
+}
+
+// A Trustline lets an account hold an asset, up to a limit it chooses.
+type Trustline struct {
+	Owner  string `json:"owner"`
+	Issuer string `json:"issuer"`
+	Code   string `json:"code"`
+
+	Balance uint64 `json:"balance"`
+
+	// The most the owner is willing to hold
+	Limit uint64 `json:"limit"`
+
+	// Only authorized trustlines can send or receive the asset
+	Authorized bool `json:"authorized"`
+}
+
+func (t *Trustline) Key() string {
+	return TrustlineKey(t.Owner, t.Issuer, t.Code)
+}
+
+func (t *Trustline) String() string {
+	return fmt.Sprintf("trustline %s:%s, owner:%s, balance:%d/%d",
+		t.Code, util.Shorten(t.Issuer), util.Shorten(t.Owner), t.Balance, t.Limit)
+}
+
+func (t *Trustline) CheckEqual(other *Trustline) error {
+	if t == nil && other == nil {
+		return nil
+	}
+	if t == nil || other == nil || *t != *other {
+		return fmt.Errorf("trustline mismatch: %+v != %+v", t, other)
+	}
+	return nil
+}
+
+// Room returns how much more of the asset this trustline can receive.
+func (t *Trustline) Room() uint64 {
+	if t.Balance >= t.Limit {
+		return 0
+	}
+	return t.Limit - t.Balance
+}
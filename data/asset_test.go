@@ -0,0 +1,268 @@
+package data
+
+import (
+	"math"
+	"testing"
+
+	"github.com/lacker/coinkit/util"
+)
+
+func TestAssetOperations(t *testing.T) {
+	issuer := util.NewKeyPairFromSecretPhrase("issuer").PublicKey().String()
+	holder := util.NewKeyPairFromSecretPhrase("holder").PublicKey().String()
+	other := util.NewKeyPairFromSecretPhrase("other").PublicKey().String()
+	c := NewCache()
+	for _, owner := range []string{issuer, holder, other} {
+		c.SetBalance(owner, 100)
+	}
+	seq := make(map[string]uint32)
+	process := func(op Operation) error {
+		if op.Verify() != nil {
+			t.Fatalf("%s should verify", op)
+		}
+		err := c.Process(op)
+		if err == nil {
+			seq[op.GetSigner()]++
+		}
+		return err
+	}
+	next := func(signer string) uint32 {
+		return seq[signer] + 1
+	}
+
+	// Creating the asset
+	err := process(&IssueOperation{
+		Signer:       issuer,
+		Sequence:     next(issuer),
+		Code:         "POINTS",
+		AuthRequired: true,
+		Revocable:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, owner := range []string{holder, other} {
+		err = process(&TrustOperation{
+			Signer:   owner,
+			Sequence: next(owner),
+			Issuer:   issuer,
+			Code:     "POINTS",
+			Limit:    50,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.GetTrustline(holder, issuer, "POINTS").Authorized {
+		t.Fatalf("the trustline should need authorization")
+	}
+
+	// Issuing authorizes
+	issue := &IssueOperation{
+		Signer:       issuer,
+		Sequence:     next(issuer),
+		Code:         "POINTS",
+		AuthRequired: true,
+		Revocable:    true,
+		To:           holder,
+		Amount:       60,
+	}
+	if process(issue) == nil {
+		t.Fatalf("issuing should respect the trustline limit")
+	}
+	issue.Amount = 30
+	if err := process(issue); err != nil {
+		t.Fatal(err)
+	}
+	send := &SendAssetOperation{
+		Signer:   holder,
+		Sequence: next(holder),
+		Issuer:   issuer,
+		Code:     "POINTS",
+		To:       other,
+		Amount:   10,
+	}
+	if process(send) == nil {
+		t.Fatalf("the other trustline is not authorized yet")
+	}
+	err = process(&IssueOperation{
+		Signer:       issuer,
+		Sequence:     next(issuer),
+		Code:         "POINTS",
+		AuthRequired: true,
+		Revocable:    true,
+		To:           other,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process(send); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sending back to the issuer takes the asset out of circulation
+	err = process(&SendAssetOperation{
+		Signer:   holder,
+		Sequence: next(holder),
+		Issuer:   issuer,
+		Code:     "POINTS",
+		To:       issuer,
+		Amount:   5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.GetTrustline(holder, issuer, "POINTS").Balance != 15 ||
+		c.GetTrustline(other, issuer, "POINTS").Balance != 10 ||
+		c.GetAsset(issuer, "POINTS").Supply != 25 {
+		t.Fatalf("unexpected balances after sending")
+	}
+
+	// Revoking freezes the balance
+	err = process(&RevokeOperation{
+		Signer:   issuer,
+		Sequence: next(issuer),
+		Code:     "POINTS",
+		Holder:   other,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	send = &SendAssetOperation{
+		Signer:   other,
+		Sequence: next(other),
+		Issuer:   issuer,
+		Code:     "POINTS",
+		To:       holder,
+		Amount:   1,
+	}
+	if process(send) == nil {
+		t.Fatalf("a revoked trustline should not be able to send")
+	}
+
+	// A trustline can only be removed once it is empty
+	remove := &TrustOperation{
+		Signer:   holder,
+		Sequence: next(holder),
+		Issuer:   issuer,
+		Code:     "POINTS",
+	}
+	if process(remove) == nil {
+		t.Fatalf("a trustline with a balance should not be removable")
+	}
+	err = process(&SendAssetOperation{
+		Signer:   holder,
+		Sequence: next(holder),
+		Issuer:   issuer,
+		Code:     "POINTS",
+		To:       issuer,
+		Amount:   15,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	remove.Sequence = next(holder)
+	if err := process(remove); err != nil {
+		t.Fatal(err)
+	}
+	if c.GetTrustline(holder, issuer, "POINTS") != nil {
+		t.Fatalf("the trustline should be gone")
+	}
+}
+
+func TestAssetsInChunk(t *testing.T) {
+	q := NewTestingOperationQueue()
+	kp := util.NewKeyPairFromSecretPhrase("issuer")
+	issuer := kp.PublicKey().String()
+	q.cache.SetBalance(issuer, 100)
+	op := NewSignedOperation(&IssueOperation{
+		Signer:   issuer,
+		Sequence: 1,
+		Code:     "VOUCHER",
+	}, kp)
+	if !q.Add(op) {
+		t.Fatalf("could not add %s", op.Operation)
+	}
+	_, chunk := q.NewChunk(q.Operations())
+	if chunk == nil || chunk.Assets[AssetKey(issuer, "VOUCHER")] == nil {
+		t.Fatalf("the chunk should have the new asset")
+	}
+	if q.cache.ValidateChunk(chunk) != nil {
+		t.Fatalf("the chunk should be valid")
+	}
+
+	hash := chunk.Hash()
+	chunk.Assets[AssetKey(issuer, "VOUCHER")] = &Asset{
+		Code:      "VOUCHER",
+		Issuer:    issuer,
+		Revocable: true,
+	}
+	if chunk.Hash() == hash {
+		t.Fatalf("the asset should be part of the hash")
+	}
+	if q.cache.ValidateChunk(chunk) == nil {
+		t.Fatalf("a chunk with the wrong asset should not be valid")
+	}
+}
+
+func TestAssetAmountLimits(t *testing.T) {
+	issuer := util.NewKeyPairFromSecretPhrase("issuer").PublicKey().String()
+	holder := util.NewKeyPairFromSecretPhrase("holder").PublicKey().String()
+	other := util.NewKeyPairFromSecretPhrase("other").PublicKey().String()
+
+	trust := &TrustOperation{
+		Signer:   holder,
+		Sequence: 1,
+		Issuer:   issuer,
+		Code:     "POINTS",
+		Limit:    math.MaxInt64 + 1,
+	}
+	if trust.Verify() == nil {
+		t.Fatalf("a limit that does not fit in the database should not verify")
+	}
+	issue := &IssueOperation{
+		Signer:   issuer,
+		Sequence: 2,
+		Code:     "POINTS",
+		To:       holder,
+		Amount:   math.MaxInt64 + 1,
+	}
+	if issue.Verify() == nil {
+		t.Fatalf("an amount that does not fit in the database should not verify")
+	}
+
+	// The supply cannot grow past what the database can store either
+	c := NewCache()
+	for _, owner := range []string{issuer, holder, other} {
+		c.SetBalance(owner, 100)
+	}
+	if err := c.Process(&IssueOperation{Signer: issuer, Sequence: 1, Code: "POINTS"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, owner := range []string{holder, other} {
+		err := c.Process(&TrustOperation{
+			Signer:   owner,
+			Sequence: 1,
+			Issuer:   issuer,
+			Code:     "POINTS",
+			Limit:    math.MaxInt64,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	issue.Amount = math.MaxInt64
+	if err := c.Process(issue); err != nil {
+		t.Fatal(err)
+	}
+	more := &IssueOperation{
+		Signer:   issuer,
+		Sequence: 3,
+		Code:     "POINTS",
+		To:       other,
+		Amount:   1,
+	}
+	if more.Verify() != nil || c.Process(more) == nil {
+		t.Fatalf("the supply should not be able to pass %d", int64(math.MaxInt64))
+	}
+}
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// An AwaitMessage is sent by a client that wants to know when something
+// happens, rather than polling for it. The server holds on to it until either
+// what it is waiting for happens, or the timeout expires.
+// The response is a DataMessage with the current data for the signature and
+// the account. When there is a signature, the response also has its status,
+// and if the operation is rejected, the status says so.
+// An ErrorMessage means the server could not handle the request.
+type AwaitMessage struct {
+	// When Signature is nonempty, this waits for the operation with this
+	// signature to be finalized.
+	Signature string `json:"signature"`
+
+	// When Account is nonempty, this waits for the account to reach Sequence.
+	// If Signature is also provided, the operation counts as rejected when the
+	// account reaches Sequence without it.
+	Account  string `json:"account"`
+	Sequence uint32 `json:"sequence"`
+
+	// How many milliseconds to wait before responding anyway.
+	// Zero means the server default.
+	Timeout int `json:"timeout"`
+}
+
+func (m *AwaitMessage) Slot() int {
+	return 0
+}
+
+func (m *AwaitMessage) MessageType() string {
+	return "Await"
+}
+
+func (m *AwaitMessage) String() string {
+	parts := []string{"await"}
+	if m.Signature != "" {
+		parts = append(parts, fmt.Sprintf("signature=%s", util.Shorten(m.Signature)))
+	}
+	if m.Account != "" {
+		parts = append(parts, fmt.Sprintf("account=%s", util.Shorten(m.Account)))
+		parts = append(parts, fmt.Sprintf("sequence=%d", m.Sequence))
+	}
+	return strings.Join(parts, " ")
+}
+
+func init() {
+	util.RegisterMessageType(&AwaitMessage{})
+}
+
+// Check decides whether the wait is over, given the current state of the
+// account and the operation, either of which can be nil.
+// It returns an error if the operation has been rejected.
+func (m *AwaitMessage) Check(account *Account, op *SignedOperation) (bool, error) {
+	if m.Signature != "" && op != nil {
+		return true, nil
+	}
+	if m.Account == "" || account == nil || account.Sequence < m.Sequence {
+		return false, nil
+	}
+	if m.Signature != "" {
+		return true, fmt.Errorf("operation %s was rejected because sequence %d was used",
+			util.Shorten(m.Signature), m.Sequence)
+	}
+	return true, nil
+}
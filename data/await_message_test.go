@@ -0,0 +1,44 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/lacker/coinkit/util"
+)
+
+func TestAwaitMessageCheck(t *testing.T) {
+	kp := util.NewKeyPairFromSecretPhrase("alice")
+	alice := kp.PublicKey().String()
+	op := NewSignedOperation(&SendOperation{
+		Signer:   alice,
+		Sequence: 2,
+		To:       util.NewKeyPairFromSecretPhrase("bob").PublicKey().String(),
+		Amount:   10,
+		Fee:      1,
+	}, kp)
+	m := &AwaitMessage{Signature: op.Signature, Account: alice, Sequence: 2}
+	m = util.EncodeThenDecodeMessage(m).(*AwaitMessage)
+
+	done, err := m.Check(nil, nil)
+	if done || err != nil {
+		t.Fatalf("a missing account should keep waiting")
+	}
+	done, err = m.Check(&Account{Owner: alice, Sequence: 1}, nil)
+	if done || err != nil {
+		t.Fatalf("an earlier sequence should keep waiting")
+	}
+	done, err = m.Check(&Account{Owner: alice, Sequence: 2}, op)
+	if !done || err != nil {
+		t.Fatalf("a finalized operation should end the wait")
+	}
+	done, err = m.Check(&Account{Owner: alice, Sequence: 2}, nil)
+	if !done || err == nil {
+		t.Fatalf("a used sequence without the operation should be a rejection")
+	}
+
+	m = &AwaitMessage{Account: alice, Sequence: 2}
+	done, err = m.Check(&Account{Owner: alice, Sequence: 3}, nil)
+	if !done || err != nil {
+		t.Fatalf("reaching the sequence should end the wait")
+	}
+}
@@ -0,0 +1,65 @@
+package data
+
+// FeeActivationSlot is the first slot with a base fee, and the first slot
+// where the original document, bucket, and provider operations pay their fee
+// out of the signer's balance and keep the rest of it. Before it, those
+// operations reset the signer's balance to zero and chunks have no base fee,
+// and chunks from then still have to replay the way they were finalized.
+// Servers set this from the network config when they start up.
+var FeeActivationSlot = 0
+
+// resetsBalance returns whether processing an operation before
+// FeeActivationSlot resets its signer's balance. Only the operation types
+// that existed back then ever did.
+func resetsBalance(op Operation) bool {
+	switch op.(type) {
+	case *CreateDocumentOperation, *UpdateDocumentOperation, *DeleteDocumentOperation,
+		*CreateBucketOperation, *UpdateBucketOperation, *DeleteBucketOperation,
+		*CreateProviderOperation, *DeleteProviderOperation,
+		*AllocateOperation, *DeallocateOperation:
+		return true
+	}
+	return false
+}
+
+// TargetChunkSize is how many operations we want a chunk to have. When
+// chunks are bigger than this, the base fee goes up, and when they are
+// smaller, it goes down.
+const TargetChunkSize = MaxChunkSize / 2
+
+// BaseFeeChangeDenominator limits how fast the base fee changes. A full
+// chunk raises it by 1/BaseFeeChangeDenominator.
+const BaseFeeChangeDenominator = 8
+
+// NextBaseFee returns the base fee that applies after a chunk with this
+// many operations.
+// Operations must pay at least the base fee to be valid.
+func NextBaseFee(baseFee uint64, chunkSize int) uint64 {
+	if chunkSize == TargetChunkSize {
+		return baseFee
+	}
+	if chunkSize > TargetChunkSize {
+		delta := baseFee * uint64(chunkSize-TargetChunkSize) /
+			uint64(TargetChunkSize) / BaseFeeChangeDenominator
+		if delta == 0 {
+			// Otherwise, a base fee of zero could never go up
+			delta = 1
+		}
+		return baseFee + delta
+	}
+	delta := baseFee * uint64(TargetChunkSize-chunkSize) /
+		uint64(TargetChunkSize) / BaseFeeChangeDenominator
+	if delta == 0 && baseFee > 0 {
+		delta = 1
+	}
+	return baseFee - delta
+}
+
+// ChunkBaseFee returns the base fee that a chunk for this slot should have.
+// Chunks before FeeActivationSlot have none.
+func ChunkBaseFee(slot int, baseFee uint64, chunkSize int) uint64 {
+	if slot < FeeActivationSlot {
+		return 0
+	}
+	return NextBaseFee(baseFee, chunkSize)
+}
@@ -0,0 +1,55 @@
+package data
+
+import (
+	"testing"
+)
+
+func TestNextBaseFee(t *testing.T) {
+	if NextBaseFee(0, TargetChunkSize) != 0 {
+		t.Fatalf("a chunk at the target should not change the base fee")
+	}
+	if NextBaseFee(0, 1) != 0 {
+		t.Fatalf("the base fee cannot go below zero")
+	}
+	if NextBaseFee(0, MaxChunkSize) != 1 {
+		t.Fatalf("a full chunk should raise a zero base fee")
+	}
+	if NextBaseFee(800, MaxChunkSize) != 900 {
+		t.Fatalf("a full chunk should raise the base fee by an eighth")
+	}
+	if NextBaseFee(800, 0) != 700 {
+		t.Fatalf("an empty chunk should lower the base fee by an eighth")
+	}
+	if NextBaseFee(3, 1) != 2 {
+		t.Fatalf("a small base fee should still go down")
+	}
+}
+
+func TestBaseFeeActivation(t *testing.T) {
+	defer func(slot int) { FeeActivationSlot = slot }(FeeActivationSlot)
+	FeeActivationSlot = 10
+
+	// A full chunk from before activation has no base fee
+	q := NewTestingOperationQueue()
+	for i := 1; i <= MaxChunkSize; i++ {
+		op := makeTestSendOperation(i)
+		q.cache.SetBalance(op.GetSigner(), 10*op.Operation.(*SendOperation).Amount)
+		q.Add(op)
+	}
+	_, chunk := q.NewChunk(q.Operations())
+	if chunk == nil || chunk.BaseFee != 0 {
+		t.Fatalf("expected a chunk with no base fee but got %+v", chunk)
+	}
+	if err := q.cache.ValidateChunk(chunk); err != nil {
+		t.Fatalf("an old chunk should replay: %s", err)
+	}
+
+	q.cache.Slot = FeeActivationSlot
+	if q.cache.ValidateChunk(chunk) == nil {
+		t.Fatalf("a full chunk after activation should raise the base fee")
+	}
+	_, chunk = q.NewChunk(q.Operations())
+	if chunk.BaseFee != 1 || q.cache.ValidateChunk(chunk) != nil {
+		t.Fatalf("expected a valid chunk with a base fee but got %+v", chunk)
+	}
+}
@@ -3,6 +3,7 @@ package data
 import (
 	"fmt"
 	"log"
+	"math"
 	"reflect"
 	"sort"
 
@@ -48,6 +49,25 @@ type Cache struct {
 	// The key of the map is the provider id.
 	providers map[uint64]*Provider
 
+	// claimables stores a subset of the claimable balances in the database.
+	// The key of the map is the claimable balance id.
+	// nil means there is currently no such claimable balance.
+	claimables map[uint64]*ClaimableBalance
+
+	// channels stores a subset of the payment channels in the database.
+	// The key of the map is the channel id.
+	// nil means there is currently no such channel.
+	channels map[uint64]*Channel
+
+	// assets stores a subset of the assets in the database.
+	// The key of the map is the asset key.
+	assets map[string]*Asset
+
+	// trustlines stores a subset of the trustlines in the database.
+	// The key of the map is the trustline key.
+	// nil means there is currently no such trustline.
+	trustlines map[string]*Trustline
+
 	// When we are doing a read operation and we don't have data, we can use the
 	// readOnly cache. This is useful so that we can make copy-on-write versions of
 	// this data, so that we can test destructive sequences of operations without
@@ -64,6 +84,14 @@ type Cache struct {
 
 	NextDocumentID uint64
 	NextProviderID uint64
+	NextClaimID    uint64
+	NextChannelID  uint64
+
+	// Operations with a lower fee than this are not valid
+	BaseFee uint64
+
+	// The slot that operations are being processed for
+	Slot int
 }
 
 func NewCache() *Cache {
@@ -73,8 +101,14 @@ func NewCache() *Cache {
 		documents:      make(map[uint64]*Document),
 		buckets:        make(map[string]*Bucket),
 		providers:      make(map[uint64]*Provider),
+		claimables:     make(map[uint64]*ClaimableBalance),
+		channels:       make(map[uint64]*Channel),
+		assets:         make(map[string]*Asset),
+		trustlines:     make(map[string]*Trustline),
 		NextDocumentID: uint64(1),
 		NextProviderID: uint64(1),
+		NextClaimID:    uint64(1),
+		NextChannelID:  uint64(1),
 	}
 }
 
@@ -94,6 +128,10 @@ func (cache *Cache) CowCopy() *Cache {
 	c.readOnly = cache
 	c.NextDocumentID = cache.NextDocumentID
 	c.NextProviderID = cache.NextProviderID
+	c.NextClaimID = cache.NextClaimID
+	c.NextChannelID = cache.NextChannelID
+	c.BaseFee = cache.BaseFee
+	c.Slot = cache.Slot
 	return c
 }
 
@@ -132,6 +170,49 @@ func (c *Cache) CheckAgainstDatabase(db *Database) error {
 		}
 	}
 
+	// Check claimable balances
+	for id, cacheClaimable := range c.claimables {
+		dbClaimable := db.GetClaimableBalance(id)
+		err := cacheClaimable.CheckEqual(dbClaimable)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Check channels
+	for id, cacheChannel := range c.channels {
+		dbChannel := db.GetChannel(id)
+		err := cacheChannel.CheckEqual(dbChannel)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Check assets
+	for _, cacheAsset := range c.assets {
+		if cacheAsset == nil {
+			continue
+		}
+		dbAsset := db.GetAsset(cacheAsset.Issuer, cacheAsset.Code)
+		err := cacheAsset.CheckEqual(dbAsset)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Check trustlines
+	for key, cacheTrustline := range c.trustlines {
+		owner, issuer, code, err := parseTrustlineKey(key)
+		if err != nil {
+			return err
+		}
+		dbTrustline := db.GetTrustline(owner, issuer, code)
+		err = cacheTrustline.CheckEqual(dbTrustline)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -167,23 +248,12 @@ func (c *Cache) MaxBalance() uint64 {
 	return answer
 }
 
-// Checks that the data for an account is what we expect
-func (c *Cache) CheckEqual(key string, account *Account) bool {
-	a := c.GetAccount(key)
-	if a == nil && account == nil {
-		return true
-	}
-	if a == nil || account == nil {
-		return false
-	}
-	return a.Sequence == account.Sequence && a.Balance == account.Balance
-}
-
 // Do not modify the Account returned from GetAccount, because it might belong to
 // the readonly cache.
 func (c *Cache) GetAccount(owner string) *Account {
 	answer, ok := c.accounts[owner]
 	if ok {
+		cacheLookups.Inc("account", "hit")
 		return answer
 	}
 
@@ -192,6 +262,7 @@ func (c *Cache) GetAccount(owner string) *Account {
 		answer = c.readOnly.GetAccount(owner)
 	} else if c.database != nil {
 		// When there is a database, we should cache reads to reduce database access.
+		cacheLookups.Inc("account", "miss")
 		answer = c.database.GetAccount(owner)
 		c.accounts[owner] = answer
 	}
@@ -218,53 +289,97 @@ func (c *Cache) UpsertAccount(account *Account) {
 
 // SetBalance writes through.
 func (c *Cache) SetBalance(owner string, amount uint64) {
-	oldAccount := c.GetAccount(owner)
-	sequence := uint32(0)
-	if oldAccount != nil {
-		sequence = oldAccount.Sequence
-	}
-	c.UpsertAccount(&Account{
-		Owner:    owner,
-		Sequence: sequence,
-		Balance:  amount,
-	})
+	account := c.getAccountCopy(owner)
+	account.Balance = amount
+	c.UpsertAccount(account)
+}
+
+// getAccountCopy returns a copy of an account that can be modified and then
+// upserted. If there is no account, it returns a new, empty one.
+// Maps on the account are still shared, so replace them rather than
+// modifying them.
+func (c *Cache) getAccountCopy(owner string) *Account {
+	account := c.GetAccount(owner)
+	if account == nil {
+		return &Account{Owner: owner}
+	}
+	answer := *account
+	return &answer
 }
 
 // ProcessSendOperation writes through.
 // ProcessSendOperation does not sanity check its input, so be sure you validate first
 func (c *Cache) ProcessSendOperation(op *SendOperation) {
-	source := c.GetAccount(op.Signer)
-	target := c.GetAccount(op.To)
-	if target == nil {
-		target = &Account{}
-	}
-	newSource := &Account{
-		Owner:    op.Signer,
-		Sequence: op.Sequence,
-		Balance:  source.Balance - op.Amount - op.Fee,
-	}
-	newTarget := &Account{
-		Owner:    op.To,
-		Sequence: target.Sequence,
-		Balance:  target.Balance + op.Amount,
+	c.RecordPayment(&PaymentRecord{
+		Slot:      c.Slot,
+		Sender:    op.Signer,
+		Recipient: op.To,
+		Amount:    op.Amount,
+		Memo:      op.Memo,
+	})
+
+	source := c.getAccountCopy(op.Signer)
+	source.Sequence = op.Sequence
+	source.Balance -= op.Amount + op.Fee
+	c.UpsertAccount(source)
+
+	target := c.getAccountCopy(op.To)
+	target.Balance += op.Amount
+	c.UpsertAccount(target)
+}
+
+// RecordPayment writes through.
+// Payments are only kept in the database, since validating operations never
+// needs to look them up.
+func (c *Cache) RecordPayment(r *PaymentRecord) {
+	if c.database != nil {
+		check(c.database.InsertPayment(r))
 	}
-	c.UpsertAccount(newSource)
-	c.UpsertAccount(newTarget)
 }
 
 // IncrementSequence writes through.
-// Increments the sequence number for the provided op.
+// Increments the sequence number for the provided op, and charges its fee.
 // The op should already have been validated.
 func (c *Cache) IncrementSequence(op Operation) {
-	account := c.GetAccount(op.GetSigner())
+	account := c.getAccountCopy(op.GetSigner())
 	if account.Sequence+1 != op.GetSequence() {
 		panic("sequence numbers were not validated")
 	}
-	newAccount := &Account{
-		Owner:    op.GetSigner(),
-		Sequence: op.GetSequence(),
+	account.Sequence = op.GetSequence()
+	if c.Slot < FeeActivationSlot && resetsBalance(op) {
+		account.Balance = 0
+	} else {
+		account.Balance -= op.GetFee()
+	}
+	c.UpsertAccount(account)
+}
+
+// SetDelegate writes through.
+// A nil scope removes the delegate.
+func (c *Cache) SetDelegate(owner string, delegate string, scope *DelegateScope) {
+	account := c.getAccountCopy(owner)
+	delegates := make(DelegateMap)
+	for key, value := range account.Delegates {
+		delegates[key] = value
+	}
+	if scope == nil {
+		delete(delegates, delegate)
+	} else {
+		delegates[delegate] = scope
+	}
+	if len(delegates) == 0 {
+		delegates = nil
 	}
-	c.UpsertAccount(newAccount)
+	account.Delegates = delegates
+	c.UpsertAccount(account)
+}
+
+// SetAuth writes through.
+// A nil auth makes the owner key control the account alone again.
+func (c *Cache) SetAuth(owner string, auth *AccountAuth) {
+	account := c.getAccountCopy(owner)
+	account.Auth = auth
+	c.UpsertAccount(account)
 }
 
 /////////////////////
@@ -315,6 +430,7 @@ func (c *Cache) DocOwner(id uint64) string {
 func (c *Cache) GetDocument(id uint64) *Document {
 	doc, ok := c.documents[id]
 	if ok {
+		cacheLookups.Inc("document", "hit")
 		return doc
 	}
 
@@ -323,6 +439,7 @@ func (c *Cache) GetDocument(id uint64) *Document {
 	}
 	if c.database != nil {
 		// When there is a database, read from the database and cache it.
+		cacheLookups.Inc("document", "miss")
 		doc = c.database.GetDocument(id)
 		c.documents[id] = doc
 		return doc
@@ -341,6 +458,7 @@ func (c *Cache) GetDocument(id uint64) *Document {
 func (c *Cache) GetBucket(name string) *Bucket {
 	bucket, ok := c.buckets[name]
 	if ok {
+		cacheLookups.Inc("bucket", "hit")
 		return bucket
 	}
 
@@ -357,6 +475,7 @@ func (c *Cache) GetBucket(name string) *Bucket {
 
 	if c.database != nil {
 		// When there is a database, read from the database and cache it.
+		cacheLookups.Inc("bucket", "miss")
 		bucket = c.database.GetBucket(name)
 		c.buckets[name] = bucket
 		return bucket
@@ -430,6 +549,7 @@ func (c *Cache) DeleteBucket(name string) {
 func (c *Cache) GetProvider(id uint64) *Provider {
 	p, ok := c.providers[id]
 	if ok {
+		cacheLookups.Inc("provider", "hit")
 		return p
 	}
 
@@ -442,6 +562,7 @@ func (c *Cache) GetProvider(id uint64) *Provider {
 
 	if c.database != nil {
 		// When there is a database, read from the database and cache it.
+		cacheLookups.Inc("provider", "miss")
 		p = c.database.GetProvider(id)
 		c.providers[id] = p
 		return p
@@ -509,6 +630,203 @@ func (c *Cache) DeleteProvider(id uint64) {
 	}
 }
 
+/////////////////////////////
+// Claimable balance stuff
+/////////////////////////////
+
+// Claimable balances never change, so the one returned can be shared with
+// the readonly cache. Do not modify it.
+// Returns nil if there is no such claimable balance.
+func (c *Cache) GetClaimableBalance(id uint64) *ClaimableBalance {
+	b, ok := c.claimables[id]
+	if ok {
+		cacheLookups.Inc("claimable", "hit")
+		return b
+	}
+
+	if c.readOnly != nil {
+		return c.readOnly.GetClaimableBalance(id)
+	}
+	if c.database != nil {
+		// When there is a database, read from the database and cache it.
+		cacheLookups.Inc("claimable", "miss")
+		b = c.database.GetClaimableBalance(id)
+		c.claimables[id] = b
+		return b
+	}
+
+	return nil
+}
+
+// InsertClaimableBalance writes through.
+// This does not update NextClaimID.
+func (c *Cache) InsertClaimableBalance(b *ClaimableBalance) {
+	c.claimables[b.ID] = b
+	if c.database != nil {
+		check(c.database.InsertClaimableBalance(b))
+	}
+}
+
+// DeleteClaimableBalance writes through.
+func (c *Cache) DeleteClaimableBalance(id uint64) {
+	c.claimables[id] = nil
+	if c.database != nil {
+		check(c.database.DeleteClaimableBalance(id))
+	}
+}
+
+/////////////////////
+// Channel stuff
+/////////////////////
+
+// Channels are replaced rather than modified, so the one returned can be
+// shared with the readonly cache. Do not modify it.
+// Returns nil if there is no such channel.
+func (c *Cache) GetChannel(id uint64) *Channel {
+	ch, ok := c.channels[id]
+	if ok {
+		cacheLookups.Inc("channel", "hit")
+		return ch
+	}
+
+	if c.readOnly != nil {
+		return c.readOnly.GetChannel(id)
+	}
+	if c.database != nil {
+		// When there is a database, read from the database and cache it.
+		cacheLookups.Inc("channel", "miss")
+		ch = c.database.GetChannel(id)
+		c.channels[id] = ch
+		return ch
+	}
+
+	return nil
+}
+
+// UpsertChannel writes through.
+// This does not update NextChannelID.
+func (c *Cache) UpsertChannel(ch *Channel) {
+	c.channels[ch.ID] = ch
+	if c.database != nil {
+		check(c.database.UpsertChannel(ch))
+	}
+}
+
+// DeleteChannel writes through.
+func (c *Cache) DeleteChannel(id uint64) {
+	c.channels[id] = nil
+	if c.database != nil {
+		check(c.database.DeleteChannel(id))
+	}
+}
+
+// PayOutChannel gives paid to the recipient of a channel, the rest of its
+// money back to the sender, and deletes it.
+// PayOutChannel writes through.
+func (c *Cache) PayOutChannel(id uint64, paid uint64) {
+	ch := c.GetChannel(id)
+	if ch == nil || paid > ch.Amount {
+		panic("invalid channel payout")
+	}
+	c.SetBalance(ch.Recipient, c.getAccountCopy(ch.Recipient).Balance+paid)
+	c.SetBalance(ch.Sender, c.getAccountCopy(ch.Sender).Balance+ch.Amount-paid)
+	c.DeleteChannel(id)
+}
+
+/////////////////////
+// Asset stuff
+/////////////////////
+
+// Assets are replaced rather than modified, so the one returned can be
+// shared with the readonly cache. Do not modify it.
+// Returns nil if there is no such asset.
+func (c *Cache) GetAsset(issuer string, code string) *Asset {
+	key := AssetKey(issuer, code)
+	a, ok := c.assets[key]
+	if ok {
+		cacheLookups.Inc("asset", "hit")
+		return a
+	}
+
+	if c.readOnly != nil {
+		return c.readOnly.GetAsset(issuer, code)
+	}
+	if c.database != nil {
+		// When there is a database, read from the database and cache it.
+		cacheLookups.Inc("asset", "miss")
+		a = c.database.GetAsset(issuer, code)
+		c.assets[key] = a
+		return a
+	}
+
+	return nil
+}
+
+// UpsertAsset writes through.
+func (c *Cache) UpsertAsset(a *Asset) {
+	c.assets[a.Key()] = a
+	if c.database != nil {
+		check(c.database.UpsertAsset(a))
+	}
+}
+
+// Trustlines are replaced rather than modified, so the one returned can be
+// shared with the readonly cache. Do not modify it.
+// Returns nil if there is no such trustline.
+func (c *Cache) GetTrustline(owner string, issuer string, code string) *Trustline {
+	key := TrustlineKey(owner, issuer, code)
+	t, ok := c.trustlines[key]
+	if ok {
+		cacheLookups.Inc("trustline", "hit")
+		return t
+	}
+
+	if c.readOnly != nil {
+		return c.readOnly.GetTrustline(owner, issuer, code)
+	}
+	if c.database != nil {
+		// When there is a database, read from the database and cache it.
+		cacheLookups.Inc("trustline", "miss")
+		t = c.database.GetTrustline(owner, issuer, code)
+		c.trustlines[key] = t
+		return t
+	}
+
+	return nil
+}
+
+// UpsertTrustline writes through.
+func (c *Cache) UpsertTrustline(t *Trustline) {
+	c.trustlines[t.Key()] = t
+	if c.database != nil {
+		check(c.database.UpsertTrustline(t))
+	}
+}
+
+// DeleteTrustline writes through.
+func (c *Cache) DeleteTrustline(owner string, issuer string, code string) {
+	c.trustlines[TrustlineKey(owner, issuer, code)] = nil
+	if c.database != nil {
+		check(c.database.DeleteTrustline(owner, issuer, code))
+	}
+}
+
+// SetTrustlineBalance writes through.
+// The trustline should already exist.
+func (c *Cache) SetTrustlineBalance(owner string, issuer string, code string, balance uint64) {
+	t := *c.GetTrustline(owner, issuer, code)
+	t.Balance = balance
+	c.UpsertTrustline(&t)
+}
+
+// SetSupply writes through.
+// The asset should already exist.
+func (c *Cache) SetSupply(issuer string, code string, supply uint64) {
+	a := *c.GetAsset(issuer, code)
+	a.Supply = supply
+	c.UpsertAsset(&a)
+}
+
 /////////////////////
 // Allocation stuff
 /////////////////////
@@ -567,6 +885,13 @@ func (c *Cache) Validate(operation Operation) error {
 		return fmt.Errorf("%d is not the right sequence id for user %s",
 			operation.GetSequence(), operation.GetSigner())
 	}
+	if err := operation.GetValidity().ValidAt(c.Slot); err != nil {
+		return err
+	}
+	if operation.GetFee() < c.BaseFee {
+		return fmt.Errorf("a fee of %d is less than the base fee of %d",
+			operation.GetFee(), c.BaseFee)
+	}
 	if account.Balance < operation.GetFee() {
 		return fmt.Errorf("user %s cannot pay a fee of %d",
 			operation.GetSigner(), operation.GetFee())
@@ -580,6 +905,186 @@ func (c *Cache) Validate(operation Operation) error {
 		}
 		return nil
 
+	case *SetSignersOperation:
+		return nil
+
+	case *MultiSendOperation:
+		// The fee was already checked, and checking it this way cannot overflow
+		if account.Balance-op.Fee < op.Total() {
+			return fmt.Errorf("user %s cannot send %d and pay a fee of %d",
+				op.Signer, op.Total(), op.Fee)
+		}
+		return nil
+
+	case *CreateClaimableBalanceOperation:
+		// The fee was already checked, and checking it this way cannot overflow
+		if account.Balance-op.Fee < op.Amount {
+			return fmt.Errorf("user %s cannot lock up %d and pay a fee of %d",
+				op.Signer, op.Amount, op.Fee)
+		}
+		return nil
+
+	case *ClaimOperation:
+		b := c.GetClaimableBalance(op.ID)
+		if b == nil {
+			return fmt.Errorf("no claimable balance with id %d", op.ID)
+		}
+		claimant := b.GetClaimant(op.Signer)
+		if claimant == nil {
+			return fmt.Errorf("user %s cannot claim balance %d", op.Signer, op.ID)
+		}
+		if claimant.Predicate != nil && !claimant.Predicate.Evaluate(c.Slot, op.Preimage) {
+			return fmt.Errorf("the predicate for claiming balance %d is not met", op.ID)
+		}
+		return nil
+
+	case *OpenChannelOperation:
+		// The fee was already checked, and checking it this way cannot overflow
+		if account.Balance-op.Fee < op.Amount {
+			return fmt.Errorf("user %s cannot lock up %d and pay a fee of %d",
+				op.Signer, op.Amount, op.Fee)
+		}
+		return nil
+
+	case *CloseChannelOperation:
+		ch := c.GetChannel(op.ID)
+		if ch == nil {
+			return fmt.Errorf("no channel with id %d", op.ID)
+		}
+		if op.Signer != ch.Sender && op.Signer != ch.Recipient {
+			return fmt.Errorf("user %s is not part of channel %d", op.Signer, op.ID)
+		}
+		if op.Signer == ch.Sender && ch.ClosingSlot != 0 {
+			return fmt.Errorf("channel %d is already closing", op.ID)
+		}
+		if op.Update != nil {
+			return ch.CheckUpdate(op.Update)
+		}
+		return nil
+
+	case *SettleChannelOperation:
+		ch := c.GetChannel(op.ID)
+		if ch == nil {
+			return fmt.Errorf("no channel with id %d", op.ID)
+		}
+		if op.Signer != ch.Sender && op.Signer != ch.Recipient {
+			return fmt.Errorf("user %s is not part of channel %d", op.Signer, op.ID)
+		}
+		if ch.ClosingSlot == 0 {
+			return fmt.Errorf("channel %d has not been closed", op.ID)
+		}
+		if c.Slot < ch.ClosingSlot {
+			return fmt.Errorf("channel %d cannot be settled until slot %d", op.ID, ch.ClosingSlot)
+		}
+		return nil
+
+	case *IssueOperation:
+		asset := c.GetAsset(op.Signer, op.Code)
+		if asset != nil && (asset.AuthRequired != op.AuthRequired || asset.Revocable != op.Revocable) {
+			return fmt.Errorf("the flags for asset %s cannot be changed", op.Code)
+		}
+		if op.To == "" {
+			if asset != nil {
+				return fmt.Errorf("asset %s already exists", op.Code)
+			}
+			return nil
+		}
+		t := c.GetTrustline(op.To, op.Signer, op.Code)
+		if t == nil {
+			return fmt.Errorf("user %s has no trustline for asset %s", op.To, op.Code)
+		}
+		if op.Amount > t.Room() {
+			return fmt.Errorf("user %s can only receive %d more of asset %s",
+				op.To, t.Room(), op.Code)
+		}
+		// The database stores the supply as a signed 64-bit integer
+		if asset != nil && op.Amount > math.MaxInt64-asset.Supply {
+			return fmt.Errorf("the supply of asset %s cannot grow by %d", op.Code, op.Amount)
+		}
+		return nil
+
+	case *TrustOperation:
+		asset := c.GetAsset(op.Issuer, op.Code)
+		if asset == nil {
+			return fmt.Errorf("user %s has not issued asset %s", op.Issuer, op.Code)
+		}
+		t := c.GetTrustline(op.Signer, op.Issuer, op.Code)
+		if t == nil {
+			if op.Limit == 0 {
+				return fmt.Errorf("user %s has no trustline for asset %s to remove",
+					op.Signer, op.Code)
+			}
+			return nil
+		}
+		if op.Limit < t.Balance {
+			return fmt.Errorf("user %s holds %d of asset %s, which is over a limit of %d",
+				op.Signer, t.Balance, op.Code, op.Limit)
+		}
+		return nil
+
+	case *SendAssetOperation:
+		asset := c.GetAsset(op.Issuer, op.Code)
+		if asset == nil {
+			return fmt.Errorf("user %s has not issued asset %s", op.Issuer, op.Code)
+		}
+		source := c.GetTrustline(op.Signer, op.Issuer, op.Code)
+		if source == nil || !source.Authorized {
+			return fmt.Errorf("user %s is not authorized to send asset %s", op.Signer, op.Code)
+		}
+		if source.Balance < op.Amount {
+			return fmt.Errorf("user %s only holds %d of asset %s",
+				op.Signer, source.Balance, op.Code)
+		}
+		if op.To == op.Issuer {
+			return nil
+		}
+		target := c.GetTrustline(op.To, op.Issuer, op.Code)
+		if target == nil || !target.Authorized {
+			return fmt.Errorf("user %s is not authorized to receive asset %s", op.To, op.Code)
+		}
+		if op.Amount > target.Room() {
+			return fmt.Errorf("user %s can only receive %d more of asset %s",
+				op.To, target.Room(), op.Code)
+		}
+		return nil
+
+	case *RevokeOperation:
+		asset := c.GetAsset(op.Signer, op.Code)
+		if asset == nil {
+			return fmt.Errorf("user %s has not issued asset %s", op.Signer, op.Code)
+		}
+		if !asset.Revocable {
+			return fmt.Errorf("asset %s is not revocable", op.Code)
+		}
+		t := c.GetTrustline(op.Holder, op.Signer, op.Code)
+		if t == nil || !t.Authorized {
+			return fmt.Errorf("user %s has no authorized trustline for asset %s",
+				op.Holder, op.Code)
+		}
+		return nil
+
+	case *DelegateOperation:
+		_, ok := account.Delegates[op.Delegate]
+		if op.Scope == nil && !ok {
+			return fmt.Errorf("%s is not a delegate for user %s", op.Delegate, op.Signer)
+		}
+		if op.Scope != nil && !ok && len(account.Delegates) >= MaxDelegates {
+			return fmt.Errorf("user %s already has %d delegates", op.Signer, MaxDelegates)
+		}
+		return nil
+
+	case *TransactionOperation:
+		// Try the whole transaction on a copy, so that nothing is changed
+		// unless every operation in it succeeds
+		layer := c.CowCopy()
+		layer.IncrementSequence(op)
+		return layer.processTransaction(op)
+
+	case *SponsoredOperation:
+		layer := c.CowCopy()
+		layer.IncrementSequence(op)
+		return layer.processSponsored(op)
+
 	case *CreateDocumentOperation:
 		return nil
 
@@ -676,6 +1181,151 @@ func (c *Cache) Validate(operation Operation) error {
 	}
 }
 
+// Authorize returns an error unless the keys that signed an operation are
+// enough for the signer's account to authorize it.
+// The signatures on a transaction need to authorize every operation in it,
+// as of before the transaction is processed. The signatures on a sponsored
+// operation need to authorize both the sponsor and the inner operation.
+func (c *Cache) Authorize(op *SignedOperation) error {
+	_, err := c.authorize(op)
+	return err
+}
+
+// authorize is like Authorize, but when the operation is only authorized
+// because a delegate signed it, it also returns the delegate's key.
+// Delegates can only authorize operations that are not in an envelope.
+func (c *Cache) authorize(op *SignedOperation) (string, error) {
+	keys := op.Keys()
+	authorize := func(operation Operation, sponsored bool) error {
+		account := c.GetAccount(operation.GetSigner())
+		if account == nil && sponsored {
+			// A sponsored operation can be the first one for a new account
+			account = &Account{Owner: operation.GetSigner()}
+		}
+		if account == nil {
+			return fmt.Errorf("no account exists for user %s", operation.GetSigner())
+		}
+		if !account.Authorizes(keys, AuthCategory(operation)) {
+			return fmt.Errorf("the signatures on %s are not enough to authorize it for user %s",
+				util.Shorten(op.Signature), operation.GetSigner())
+		}
+		return nil
+	}
+
+	err := authorize(op.Operation, false)
+	switch t := op.Operation.(type) {
+	case *TransactionOperation:
+		if err != nil {
+			return "", err
+		}
+		for _, inner := range t.Operations {
+			err = authorize(inner.Operation, false)
+			if err != nil {
+				return "", err
+			}
+		}
+	case *SponsoredOperation:
+		if err != nil {
+			return "", err
+		}
+		return "", authorize(t.Operation.Operation, true)
+	default:
+		if err != nil {
+			return c.authorizeDelegate(op, keys, err)
+		}
+	}
+	return "", nil
+}
+
+// authorizeDelegate checks whether a delegate of the signer signed an
+// operation, and its scope permits it. If not, it returns the provided error,
+// or the reason a delegate that signed was not permitted.
+func (c *Cache) authorizeDelegate(op *SignedOperation, keys []string, err error) (string, error) {
+	account := c.GetAccount(op.GetSigner())
+	if account == nil {
+		return "", err
+	}
+	for _, key := range keys {
+		scope := account.Delegates[key]
+		if scope == nil {
+			continue
+		}
+		permitErr := scope.Permits(op.Operation, c.Slot)
+		if permitErr == nil {
+			return key, nil
+		}
+		err = fmt.Errorf("delegate %s cannot act for user %s: %s",
+			util.Shorten(key), op.GetSigner(), permitErr)
+	}
+	return "", err
+}
+
+// ValidateSigned is like Validate, but it also checks that the operation is
+// authorized by the keys that signed it.
+func (c *Cache) ValidateSigned(op *SignedOperation) error {
+	_, err := c.authorize(op)
+	if err != nil {
+		return err
+	}
+	return c.Validate(op.Operation)
+}
+
+// ProcessSigned is like Process, but it also checks that the operation is
+// authorized by the keys that signed it, and charges any delegate that
+// authorized it.
+func (c *Cache) ProcessSigned(op *SignedOperation) error {
+	delegate, err := c.authorize(op)
+	if err != nil {
+		return err
+	}
+	err = c.Process(op.Operation)
+	if err != nil {
+		return err
+	}
+	if delegate != "" {
+		account := c.getAccountCopy(op.GetSigner())
+		scope := account.Delegates[delegate].Charge(op.Operation, c.Slot)
+		c.SetDelegate(op.GetSigner(), delegate, scope)
+	}
+	return nil
+}
+
+// processTransaction processes the operations inside a transaction in order.
+// They pay no fees of their own, since the transaction pays for all of them.
+// It stops at the first operation that fails, so it should only be called
+// directly on a copy.
+func (c *Cache) processTransaction(op *TransactionOperation) error {
+	for i, inner := range op.Operations {
+		err := c.processFeeless(inner.Operation)
+		if err != nil {
+			return fmt.Errorf("operation %d in the transaction failed: %s", i, err)
+		}
+	}
+	return nil
+}
+
+// processSponsored processes the operation inside a sponsored operation,
+// creating the account of its signer if needed.
+// Like processTransaction, it should only be called directly on a copy.
+func (c *Cache) processSponsored(op *SponsoredOperation) error {
+	signer := op.Operation.GetSigner()
+	if c.GetAccount(signer) == nil {
+		c.UpsertAccount(&Account{Owner: signer})
+	}
+	return c.processFeeless(op.Operation.Operation)
+}
+
+// processFeeless processes an operation whose fee was paid by an envelope
+// around it, so it does not need to meet the base fee.
+func (c *Cache) processFeeless(op Operation) error {
+	baseFee := c.BaseFee
+	c.BaseFee = 0
+	defer func() {
+		c.BaseFee = baseFee
+	}()
+	return c.Process(op)
+}
+
 // Process returns an error iff the operation cannot be processed
 func (c *Cache) Process(operation Operation) error {
 	err := c.Validate(operation)
@@ -689,6 +1339,164 @@ func (c *Cache) Process(operation Operation) error {
 		c.ProcessSendOperation(op)
 		return nil
 
+	case *SetSignersOperation:
+		c.IncrementSequence(op)
+		c.SetAuth(op.Signer, op.Auth)
+		return nil
+
+	case *MultiSendOperation:
+		c.IncrementSequence(op)
+		c.SetBalance(op.Signer, c.GetAccount(op.Signer).Balance-op.Total())
+		for _, p := range op.Payments {
+			c.SetBalance(p.To, c.getAccountCopy(p.To).Balance+p.Amount)
+			c.RecordPayment(&PaymentRecord{
+				Slot:      c.Slot,
+				Sender:    op.Signer,
+				Recipient: p.To,
+				Amount:    p.Amount,
+				Memo:      p.Memo,
+			})
+		}
+		return nil
+
+	case *CreateClaimableBalanceOperation:
+		c.IncrementSequence(op)
+		c.SetBalance(op.Signer, c.GetAccount(op.Signer).Balance-op.Amount)
+		c.InsertClaimableBalance(&ClaimableBalance{
+			ID:        c.NextClaimID,
+			Owner:     op.Signer,
+			Amount:    op.Amount,
+			Claimants: op.Claimants,
+		})
+		c.NextClaimID++
+		return nil
+
+	case *ClaimOperation:
+		c.IncrementSequence(op)
+		b := c.GetClaimableBalance(op.ID)
+		c.SetBalance(op.Signer, c.GetAccount(op.Signer).Balance+b.Amount)
+		c.DeleteClaimableBalance(op.ID)
+		return nil
+
+	case *OpenChannelOperation:
+		c.IncrementSequence(op)
+		c.SetBalance(op.Signer, c.GetAccount(op.Signer).Balance-op.Amount)
+		c.UpsertChannel(&Channel{
+			ID:            c.NextChannelID,
+			Sender:        op.Signer,
+			Recipient:     op.Recipient,
+			Amount:        op.Amount,
+			DisputeWindow: op.DisputeWindow,
+		})
+		c.NextChannelID++
+		return nil
+
+	case *CloseChannelOperation:
+		c.IncrementSequence(op)
+		ch := c.GetChannel(op.ID)
+		if op.Signer == ch.Recipient {
+			// A pending close by the sender may have promised more
+			paid := op.Paid()
+			if ch.ClosingPaid > paid {
+				paid = ch.ClosingPaid
+			}
+			c.PayOutChannel(op.ID, paid)
+			return nil
+		}
+		closing := *ch
+		closing.ClosingSlot = c.Slot + ch.DisputeWindow
+		closing.ClosingPaid = op.Paid()
+		c.UpsertChannel(&closing)
+		return nil
+
+	case *SettleChannelOperation:
+		c.IncrementSequence(op)
+		c.PayOutChannel(op.ID, c.GetChannel(op.ID).ClosingPaid)
+		return nil
+
+	case *IssueOperation:
+		c.IncrementSequence(op)
+		asset := c.GetAsset(op.Signer, op.Code)
+		if asset == nil {
+			asset = &Asset{
+				Code:         op.Code,
+				Issuer:       op.Signer,
+				AuthRequired: op.AuthRequired,
+				Revocable:    op.Revocable,
+			}
+			c.UpsertAsset(asset)
+		}
+		if op.To != "" {
+			t := *c.GetTrustline(op.To, op.Signer, op.Code)
+			t.Balance += op.Amount
+			t.Authorized = true
+			c.UpsertTrustline(&t)
+			c.SetSupply(op.Signer, op.Code, asset.Supply+op.Amount)
+		}
+		return nil
+
+	case *TrustOperation:
+		c.IncrementSequence(op)
+		t := c.GetTrustline(op.Signer, op.Issuer, op.Code)
+		if op.Limit == 0 {
+			c.DeleteTrustline(op.Signer, op.Issuer, op.Code)
+			return nil
+		}
+		if t == nil {
+			t = &Trustline{
+				Owner:      op.Signer,
+				Issuer:     op.Issuer,
+				Code:       op.Code,
+				Authorized: !c.GetAsset(op.Issuer, op.Code).AuthRequired,
+			}
+		} else {
+			copy := *t
+			t = &copy
+		}
+		t.Limit = op.Limit
+		c.UpsertTrustline(t)
+		return nil
+
+	case *SendAssetOperation:
+		c.IncrementSequence(op)
+		source := c.GetTrustline(op.Signer, op.Issuer, op.Code)
+		c.SetTrustlineBalance(op.Signer, op.Issuer, op.Code, source.Balance-op.Amount)
+		if op.To == op.Issuer {
+			supply := c.GetAsset(op.Issuer, op.Code).Supply
+			c.SetSupply(op.Issuer, op.Code, supply-op.Amount)
+			return nil
+		}
+		target := c.GetTrustline(op.To, op.Issuer, op.Code)
+		c.SetTrustlineBalance(op.To, op.Issuer, op.Code, target.Balance+op.Amount)
+		return nil
+
+	case *RevokeOperation:
+		c.IncrementSequence(op)
+		t := *c.GetTrustline(op.Holder, op.Signer, op.Code)
+		t.Authorized = false
+		c.UpsertTrustline(&t)
+		return nil
+
+	case *DelegateOperation:
+		c.IncrementSequence(op)
+		c.SetDelegate(op.Signer, op.Delegate, op.Scope)
+		return nil
+
+	case *TransactionOperation:
+		c.IncrementSequence(op)
+		if err := c.processTransaction(op); err != nil {
+			// Validation already processed the same operations on a copy
+			util.Logger.Fatalf("a validated transaction failed: %s", err)
+		}
+		return nil
+
+	case *SponsoredOperation:
+		c.IncrementSequence(op)
+		if err := c.processSponsored(op); err != nil {
+			util.Logger.Fatalf("a validated sponsored operation failed: %s", err)
+		}
+		return nil
+
 	case *CreateDocumentOperation:
 		c.IncrementSequence(op)
 		doc := NewDocumentFromOperation(c.NextDocumentID, op)
@@ -779,6 +1587,7 @@ func (c *Cache) FinalizeBlock(block *Block) {
 	}
 
 	c.blocks[block.Slot] = block
+	c.Slot = block.Slot + 1
 
 	if c.database != nil {
 		check(c.database.InsertBlock(block))
@@ -807,15 +1616,31 @@ func (c *Cache) ProcessChunk(chunk *LedgerChunk) error {
 		if err != nil {
 			return fmt.Errorf("op %s failed to verify: %s", op, err)
 		}
-		err = c.Process(op.Operation)
+		err = c.ProcessSigned(op)
 		if err != nil {
 			return fmt.Errorf("op %s failed to process: %s", op, err)
 		}
 	}
 
 	for owner, account := range chunk.Accounts {
-		if !c.CheckEqual(owner, account) {
-			return fmt.Errorf("integrity checks failed after chunk processing")
+		// This compares every hashed field, so a chunk cannot forge any of them
+		if err := c.GetAccount(owner).CheckEqual(account); err != nil {
+			return fmt.Errorf("integrity checks failed after chunk processing: %s", err)
+		}
+	}
+	for key, asset := range chunk.Assets {
+		if asset == nil || asset.Key() != key ||
+			asset.CheckEqual(c.GetAsset(asset.Issuer, asset.Code)) != nil {
+			return fmt.Errorf("asset integrity checks failed after chunk processing")
+		}
+	}
+	for key, trustline := range chunk.Trustlines {
+		owner, issuer, code, err := parseTrustlineKey(key)
+		if err != nil {
+			return err
+		}
+		if trustline.CheckEqual(c.GetTrustline(owner, issuer, code)) != nil {
+			return fmt.Errorf("trustline integrity checks failed after chunk processing")
 		}
 	}
 
@@ -827,6 +1652,19 @@ func (c *Cache) ProcessChunk(chunk *LedgerChunk) error {
 		return fmt.Errorf("bad NextProviderID")
 	}
 
+	// Chunks from before these ids existed do not have them
+	if chunk.NextClaimID != 0 && c.NextClaimID != chunk.NextClaimID {
+		return fmt.Errorf("bad NextClaimID")
+	}
+	if chunk.NextChannelID != 0 && c.NextChannelID != chunk.NextChannelID {
+		return fmt.Errorf("bad NextChannelID")
+	}
+
+	c.BaseFee = ChunkBaseFee(c.Slot, c.BaseFee, len(chunk.Operations))
+	if c.BaseFee != chunk.BaseFee {
+		return fmt.Errorf("bad BaseFee")
+	}
+
 	return nil
 }
 
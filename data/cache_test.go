@@ -316,3 +316,243 @@ func TestAllocationProcessing(t *testing.T) {
 
 	db.Commit()
 }
+
+func TestBaseFeeValidation(t *testing.T) {
+	c := NewCache()
+	c.SetBalance("alice", 100)
+	c.BaseFee = 5
+	op := &DeleteDocumentOperation{
+		Signer:   "alice",
+		Sequence: 1,
+		ID:       1,
+		Fee:      4,
+	}
+	if c.Validate(op) == nil {
+		t.Fatalf("a fee below the base fee should be rejected")
+	}
+	c.BaseFee = 4
+	c.InsertDocument(&Document{ID: 1, Data: NewJSONObject(map[string]interface{}{"owner": "alice"})})
+	if c.Validate(op) != nil {
+		t.Fatalf("a fee at the base fee should be accepted")
+	}
+}
+
+func TestIncrementSequenceChargesFee(t *testing.T) {
+	c := NewCache()
+	c.SetBalance("alice", 100)
+	doc := NewJSONObject(map[string]interface{}{"owner": "alice"})
+	c.InsertDocument(&Document{ID: 1, Data: doc})
+	c.InsertDocument(&Document{ID: 2, Data: doc})
+
+	// The fee is charged, and the rest of the balance is kept
+	err := c.Process(&DeleteDocumentOperation{
+		Signer:   "alice",
+		Sequence: 1,
+		ID:       1,
+		Fee:      4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.GetAccount("alice").Balance != 96 {
+		t.Fatalf("unexpected account: %+v", c.GetAccount("alice"))
+	}
+
+	// Old chunks replay the way they were finalized
+	defer func(slot int) { FeeActivationSlot = slot }(FeeActivationSlot)
+	FeeActivationSlot = 10
+	c.Slot = 9
+	err = c.Process(&DeleteDocumentOperation{
+		Signer:   "alice",
+		Sequence: 2,
+		ID:       2,
+		Fee:      4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.GetAccount("alice").Balance != 0 {
+		t.Fatalf("unexpected account before activation: %+v", c.GetAccount("alice"))
+	}
+}
+
+func TestNewOperationsKeepBalanceBeforeActivation(t *testing.T) {
+	defer func(slot int) { FeeActivationSlot = slot }(FeeActivationSlot)
+	FeeActivationSlot = 10
+	bob := util.NewKeyPairFromSecretPhrase("bob").PublicKey().String()
+
+	// Each case runs its operation for alice, who starts with 100, and says
+	// what alice should have afterwards.
+	cases := map[string]func(c *Cache) (Operation, uint64){
+		"multisend": func(c *Cache) (Operation, uint64) {
+			return &MultiSendOperation{
+				Signer:   "alice",
+				Sequence: 1,
+				Fee:      1,
+				Payments: []*Payment{&Payment{To: bob, Amount: 50}},
+			}, 49
+		},
+		"createclaimable": func(c *Cache) (Operation, uint64) {
+			return &CreateClaimableBalanceOperation{
+				Signer:    "alice",
+				Sequence:  1,
+				Fee:       1,
+				Amount:    50,
+				Claimants: []*Claimant{&Claimant{Destination: bob}},
+			}, 49
+		},
+		"claim": func(c *Cache) (Operation, uint64) {
+			c.InsertClaimableBalance(&ClaimableBalance{
+				ID:        c.NextClaimID,
+				Owner:     bob,
+				Amount:    30,
+				Claimants: []*Claimant{&Claimant{Destination: "alice"}},
+			})
+			c.NextClaimID++
+			return &ClaimOperation{
+				Signer:   "alice",
+				Sequence: 1,
+				Fee:      1,
+				ID:       c.NextClaimID - 1,
+			}, 129
+		},
+		"openchannel": func(c *Cache) (Operation, uint64) {
+			return &OpenChannelOperation{
+				Signer:        "alice",
+				Sequence:      1,
+				Fee:           1,
+				Recipient:     bob,
+				Amount:        50,
+				DisputeWindow: 5,
+			}, 49
+		},
+	}
+	for name, makeOp := range cases {
+		for _, slot := range []int{5, FeeActivationSlot} {
+			c := NewCache()
+			c.Slot = slot
+			c.NextClaimID = 1
+			c.NextChannelID = 1
+			c.SetBalance("alice", 100)
+			op, expected := makeOp(c)
+			if err := c.Process(op); err != nil {
+				t.Fatalf("%s at slot %d: %s", name, slot, err)
+			}
+			if c.GetAccount("alice").Balance != expected {
+				t.Fatalf("%s at slot %d left alice with %d instead of %d",
+					name, slot, c.GetAccount("alice").Balance, expected)
+			}
+		}
+	}
+}
+
+func TestMultisigAuthorization(t *testing.T) {
+	owner := util.NewKeyPairFromSecretPhrase("treasury")
+	a := util.NewKeyPairFromSecretPhrase("a")
+	b := util.NewKeyPairFromSecretPhrase("b")
+	c := NewCache()
+	c.SetBalance(owner.PublicKey().String(), 100)
+
+	setSigners := func(sequence uint32, auth *AccountAuth) *SignedOperation {
+		return NewSignedOperation(&SetSignersOperation{
+			Signer:   owner.PublicKey().String(),
+			Sequence: sequence,
+			Auth:     auth,
+		}, owner)
+	}
+	send := func(sequence uint32, kp *util.KeyPair) *SignedOperation {
+		return NewSignedOperationWithKey(&SendOperation{
+			Signer:   owner.PublicKey().String(),
+			Sequence: sequence,
+			To:       "bob",
+			Amount:   1,
+		}, kp)
+	}
+
+	err := c.ProcessSigned(setSigners(1, &AccountAuth{
+		Signers: map[string]uint32{
+			owner.PublicKey().String(): 2,
+			a.PublicKey().String():     1,
+			b.PublicKey().String():     1,
+		},
+		Low:    1,
+		Medium: 2,
+		High:   3,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.ValidateSigned(send(2, a)) == nil {
+		t.Fatalf("one low-weight key should not be able to send")
+	}
+	op := send(2, a)
+	op.Cosign(b)
+	if err := c.ProcessSigned(op); err != nil {
+		t.Fatal(err)
+	}
+	if c.ValidateSigned(setSigners(3, nil)) == nil {
+		t.Fatalf("the owner key alone should not meet the high threshold")
+	}
+
+	// Rotate to a single new key
+	rotate := setSigners(3, &AccountAuth{
+		Signers: map[string]uint32{b.PublicKey().String(): 1},
+		Low:     1,
+		Medium:  1,
+		High:    1,
+	})
+	rotate.Cosign(a)
+	if err := c.ProcessSigned(rotate); err != nil {
+		t.Fatal(err)
+	}
+	if c.ValidateSigned(send(4, owner)) == nil {
+		t.Fatalf("the owner key should not work after rotation")
+	}
+	if err := c.ProcessSigned(send(4, b)); err != nil {
+		t.Fatal(err)
+	}
+	if c.GetAccount("bob").Balance != 2 {
+		t.Fatalf("unexpected account: %+v", c.GetAccount("bob"))
+	}
+}
+
+func TestAccountAuthCheck(t *testing.T) {
+	a := util.NewKeyPairFromSecretPhrase("a").PublicKey().String()
+	auth := &AccountAuth{
+		Signers: map[string]uint32{a: 1},
+		Low:     1,
+		Medium:  1,
+		High:    2,
+	}
+	if auth.Check() == nil {
+		t.Fatalf("an unreachable high threshold should be rejected")
+	}
+	auth.High = 1
+	if err := auth.Check(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChunkAccountsMustMatch(t *testing.T) {
+	q := NewTestingOperationQueue()
+	op := makeTestSendOperation(5)
+	q.cache.SetBalance(op.GetSigner(), 100)
+	q.Add(op)
+	_, chunk := q.NewChunk(q.Operations())
+	if err := q.cache.ValidateChunk(chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := *chunk.Accounts[op.GetSigner()]
+	tampered.Auth = &AccountAuth{
+		Signers: map[string]uint32{"mallory": 1},
+		Low:     1,
+		Medium:  1,
+		High:    1,
+	}
+	chunk.Accounts[op.GetSigner()] = &tampered
+	if q.cache.ValidateChunk(chunk) == nil {
+		t.Fatalf("a chunk should not be able to change an account's auth")
+	}
+}
@@ -0,0 +1,90 @@
+package data
+
+import (
+	"fmt"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// MaxDisputeWindow is the longest dispute window a channel can have, in slots.
+const MaxDisputeWindow = 10000
+
+// A Channel is a one-way payment channel. The sender locks up money when
+// opening it, and then pays the recipient by signing ChannelUpdates off-chain.
+// Only the final state goes back on the blockchain.
+type Channel struct {
+	// Every channel gets a unique id, assigned by the blockchain.
+	ID uint64 `json:"id"`
+
+	Sender    string `json:"sender"`
+	Recipient string `json:"recipient"`
+
+	// How much money the sender locked up
+	Amount uint64 `json:"amount"`
+
+	// How many slots the recipient has to dispute a close by the sender
+	DisputeWindow int `json:"disputeWindow"`
+
+	// When the sender closes the channel on their own, it can be settled
+	// from ClosingSlot on, paying ClosingPaid to the recipient. Until then,
+	// the recipient can close it with a later update.
+	// ClosingSlot is zero while the channel is open.
+	ClosingSlot int    `json:"closingSlot,omitempty"`
+	ClosingPaid uint64 `json:"closingPaid,omitempty"`
+}
+
+func (ch *Channel) String() string {
+	return fmt.Sprintf("channel #%d, sender:%s, recipient:%s, amount:%d",
+		ch.ID, util.Shorten(ch.Sender), util.Shorten(ch.Recipient), ch.Amount)
+}
+
+func (ch *Channel) CheckEqual(other *Channel) error {
+	if ch == nil && other == nil {
+		return nil
+	}
+	if ch == nil || other == nil || *ch != *other {
+		return fmt.Errorf("channel mismatch: %+v != %+v", ch, other)
+	}
+	return nil
+}
+
+// CheckUpdate returns an error unless the sender signed this update for this
+// channel.
+func (ch *Channel) CheckUpdate(u *ChannelUpdate) error {
+	if u.Channel != ch.ID {
+		return fmt.Errorf("the update is for channel %d, not channel %d", u.Channel, ch.ID)
+	}
+	if u.Paid > ch.Amount {
+		return fmt.Errorf("the update pays %d but channel %d only holds %d",
+			u.Paid, ch.ID, ch.Amount)
+	}
+	pk, err := util.ReadPublicKey(ch.Sender)
+	if err != nil {
+		return err
+	}
+	if !util.VerifySignature(pk, u.Payload(), u.Signature) {
+		return fmt.Errorf("invalid signature on update for channel %d", ch.ID)
+	}
+	return nil
+}
+
+// A ChannelUpdate is a promise from the sender of a channel, made off-chain,
+// that the recipient can have this much of the channel's money in total.
+// Since the channel only goes one way, a later update always pays more, and
+// the recipient only ever needs the latest one.
+type ChannelUpdate struct {
+	Channel uint64 `json:"channel"`
+	Paid    uint64 `json:"paid"`
+
+	// The sender's signature of the payload
+	Signature string `json:"signature"`
+}
+
+// Payload is what the sender signs.
+func (u *ChannelUpdate) Payload() string {
+	return fmt.Sprintf("ChannelUpdate:%d:%d", u.Channel, u.Paid)
+}
+
+func (u *ChannelUpdate) String() string {
+	return fmt.Sprintf("update channel=%d, paid=%d", u.Channel, u.Paid)
+}
@@ -0,0 +1,102 @@
+package data
+
+import (
+	"math"
+	"testing"
+
+	"github.com/lacker/coinkit/util"
+)
+
+func TestChannelProcessing(t *testing.T) {
+	alice := util.NewKeyPairFromSecretPhrase("alice")
+	bob := util.NewKeyPairFromSecretPhrase("bob").PublicKey().String()
+	sender := alice.PublicKey().String()
+	c := NewCache()
+	c.Slot = 1
+	c.SetBalance(sender, 100)
+	c.SetBalance(bob, 10)
+
+	err := c.Process(&OpenChannelOperation{
+		Signer:        sender,
+		Sequence:      1,
+		Recipient:     bob,
+		Amount:        60,
+		DisputeWindow: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.GetAccount(sender).Balance != 40 || c.GetChannel(1) == nil {
+		t.Fatalf("the money should be locked up in the channel")
+	}
+
+	update := func(paid uint64) *ChannelUpdate {
+		u := &ChannelUpdate{Channel: 1, Paid: paid}
+		u.Signature = alice.Sign(u.Payload())
+		return u
+	}
+
+	// The sender tries to close with an old update
+	err = c.Process(&CloseChannelOperation{Signer: sender, Sequence: 2, ID: 1, Update: update(10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Validate(&SettleChannelOperation{Signer: sender, Sequence: 3, ID: 1}) == nil {
+		t.Fatalf("the channel should not settle during the dispute window")
+	}
+
+	// The recipient disputes with a later one
+	forged := update(50)
+	forged.Paid = 60
+	if c.Validate(&CloseChannelOperation{Signer: bob, Sequence: 1, ID: 1, Update: forged}) == nil {
+		t.Fatalf("a forged update should be rejected")
+	}
+	err = c.Process(&CloseChannelOperation{Signer: bob, Sequence: 1, ID: 1, Update: update(50)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.GetAccount(sender).Balance != 50 || c.GetAccount(bob).Balance != 60 || c.GetChannel(1) != nil {
+		t.Fatalf("unexpected payout")
+	}
+}
+
+func TestChannelSettlement(t *testing.T) {
+	sender := util.NewKeyPairFromSecretPhrase("alice").PublicKey().String()
+	bob := util.NewKeyPairFromSecretPhrase("bob").PublicKey().String()
+	c := NewCache()
+	c.Slot = 1
+	c.SetBalance(sender, 100)
+	for i, op := range []Operation{
+		&OpenChannelOperation{Signer: sender, Sequence: 1, Recipient: bob, Amount: 60, DisputeWindow: 5},
+		&CloseChannelOperation{Signer: sender, Sequence: 2, ID: 1},
+	} {
+		if err := c.Process(op); err != nil {
+			t.Fatalf("op %d: %s", i, err)
+		}
+	}
+	c.Slot = 6
+	if err := c.Process(&SettleChannelOperation{Signer: sender, Sequence: 3, ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if c.GetAccount(sender).Balance != 100 || c.GetChannel(1) != nil {
+		t.Fatalf("the sender should get everything back")
+	}
+}
+
+func TestOpenChannelOverflow(t *testing.T) {
+	sender := util.NewKeyPairFromSecretPhrase("alice").PublicKey().String()
+	bob := util.NewKeyPairFromSecretPhrase("bob").PublicKey().String()
+	c := NewCache()
+	c.SetBalance(sender, 1)
+	op := &OpenChannelOperation{
+		Signer:        sender,
+		Sequence:      1,
+		Fee:           1,
+		Recipient:     bob,
+		Amount:        math.MaxUint64,
+		DisputeWindow: 5,
+	}
+	if c.Process(op) == nil {
+		t.Fatalf("the amount and the fee should not be able to wrap around")
+	}
+}
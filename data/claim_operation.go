@@ -0,0 +1,64 @@
+package data
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// ClaimOperation moves the money in a claimable balance to one of its
+// claimants.
+type ClaimOperation struct {
+	// Who is claiming the money. Must be one of the claimants
+	Signer string `json:"signer"`
+
+	// The sequence number for this operation
+	Sequence uint32 `json:"sequence"`
+
+	// How much the signer is willing to pay to send this operation through
+	Fee uint64 `json:"fee"`
+
+	// The slots this operation can be processed in
+	Validity
+
+	// The id of the claimable balance
+	ID uint64 `json:"id"`
+
+	// The hash preimage to reveal, in hex, for predicates that need one
+	Preimage string `json:"preimage,omitempty"`
+}
+
+func (op *ClaimOperation) String() string {
+	return fmt.Sprintf("claim owner=%s, id=%d", util.Shorten(op.Signer), op.ID)
+}
+
+func (op *ClaimOperation) OperationType() string {
+	return "Claim"
+}
+
+func (op *ClaimOperation) GetSigner() string {
+	return op.Signer
+}
+
+func (op *ClaimOperation) GetFee() uint64 {
+	return op.Fee
+}
+
+func (op *ClaimOperation) GetSequence() uint32 {
+	return op.Sequence
+}
+
+func (op *ClaimOperation) Verify() error {
+	if op.ID == 0 {
+		return fmt.Errorf("claimable balance ids start at 1")
+	}
+	if _, err := hex.DecodeString(op.Preimage); err != nil {
+		return fmt.Errorf("the preimage must be hex: %s", err)
+	}
+	return nil
+}
+
+func init() {
+	RegisterOperationType(&ClaimOperation{})
+}
@@ -0,0 +1,206 @@
+package data
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// MaxClaimants is the most claimants a single claimable balance can have.
+const MaxClaimants = 10
+
+// MaxPredicateSize is the most predicates, counting nested ones, that a
+// single claimant can have.
+const MaxPredicateSize = 20
+
+// A ClaimableBalance is money that its owner has locked up, until one of
+// the claimants claims it.
+type ClaimableBalance struct {
+	// Every claimable balance gets a unique id, assigned by the blockchain.
+	ID uint64 `json:"id"`
+
+	// Who locked up the money
+	Owner string `json:"owner"`
+
+	Amount uint64 `json:"amount"`
+
+	Claimants ClaimantArray `json:"claimants"`
+}
+
+func (b *ClaimableBalance) String() string {
+	return fmt.Sprintf("claimable #%d, owner:%s, amount:%d, claimants:%d",
+		b.ID, util.Shorten(b.Owner), b.Amount, len(b.Claimants))
+}
+
+// GetClaimant returns nil if this destination cannot claim the balance.
+func (b *ClaimableBalance) GetClaimant(destination string) *Claimant {
+	for _, claimant := range b.Claimants {
+		if claimant.Destination == destination {
+			return claimant
+		}
+	}
+	return nil
+}
+
+func (b *ClaimableBalance) CheckEqual(other *ClaimableBalance) error {
+	if b == nil && other == nil {
+		return nil
+	}
+	if b == nil || other == nil {
+		return fmt.Errorf("b != other. b is %+v, other is %+v", b, other)
+	}
+	if string(util.CanonicalJSONEncode(b)) != string(util.CanonicalJSONEncode(other)) {
+		return fmt.Errorf("claimable balance mismatch: %s != %s", b, other)
+	}
+	return nil
+}
+
+// A Claimant is someone who can claim a claimable balance, when its
+// predicate is true.
+type Claimant struct {
+	Destination string `json:"destination"`
+
+	// Nil means the claimant can claim at any time
+	Predicate *Predicate `json:"predicate,omitempty"`
+}
+
+// A Predicate is a condition for claiming a claimable balance.
+// Every condition that is set must be true for the predicate to be true,
+// and a predicate with no conditions set is always true.
+type Predicate struct {
+	// The claim must happen before this slot
+	Before int `json:"before,omitempty"`
+
+	// The claim must happen in this slot or later
+	After int `json:"after,omitempty"`
+
+	// The claim must reveal a preimage whose sha256 hash is this, in hex
+	Hash string `json:"hash,omitempty"`
+
+	// All of these predicates must be true
+	And []*Predicate `json:"and,omitempty"`
+
+	// At least one of these predicates must be true
+	Or []*Predicate `json:"or,omitempty"`
+}
+
+func (p *Predicate) String() string {
+	parts := []string{}
+	if p.Before != 0 {
+		parts = append(parts, fmt.Sprintf("before=%d", p.Before))
+	}
+	if p.After != 0 {
+		parts = append(parts, fmt.Sprintf("after=%d", p.After))
+	}
+	if p.Hash != "" {
+		parts = append(parts, fmt.Sprintf("hash=%s", util.Shorten(p.Hash)))
+	}
+	for _, sub := range p.And {
+		parts = append(parts, fmt.Sprintf("and(%s)", sub))
+	}
+	if len(p.Or) > 0 {
+		subs := []string{}
+		for _, sub := range p.Or {
+			subs = append(subs, sub.String())
+		}
+		parts = append(parts, fmt.Sprintf("or(%s)", strings.Join(subs, ", ")))
+	}
+	return strings.Join(parts, " ")
+}
+
+// size counts this predicate and all the predicates nested in it.
+func (p *Predicate) size() int {
+	answer := 1
+	for _, sub := range append(p.And, p.Or...) {
+		if sub != nil {
+			answer += sub.size()
+		}
+	}
+	return answer
+}
+
+// Check returns an error if the predicate is malformed.
+func (p *Predicate) Check() error {
+	if p.size() > MaxPredicateSize {
+		return fmt.Errorf("a predicate can have at most %d parts", MaxPredicateSize)
+	}
+	return p.check()
+}
+
+func (p *Predicate) check() error {
+	if p.Before < 0 || p.After < 0 {
+		return errors.New("predicate slots cannot be negative")
+	}
+	if p.Hash != "" {
+		bytes, err := hex.DecodeString(p.Hash)
+		if err != nil || len(bytes) != sha256.Size {
+			return fmt.Errorf("bad predicate hash: %s", p.Hash)
+		}
+	}
+	for _, sub := range append(p.And, p.Or...) {
+		if sub == nil {
+			return errors.New("nil predicate")
+		}
+		if err := sub.check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Evaluate returns whether a claim in this slot, revealing this preimage,
+// satisfies the predicate. The preimage is in hex.
+func (p *Predicate) Evaluate(slot int, preimage string) bool {
+	if p.Before != 0 && slot >= p.Before {
+		return false
+	}
+	if p.After != 0 && slot < p.After {
+		return false
+	}
+	if p.Hash != "" {
+		bytes, err := hex.DecodeString(preimage)
+		if err != nil {
+			return false
+		}
+		hash := sha256.Sum256(bytes)
+		if hex.EncodeToString(hash[:]) != strings.ToLower(p.Hash) {
+			return false
+		}
+	}
+	for _, sub := range p.And {
+		if !sub.Evaluate(slot, preimage) {
+			return false
+		}
+	}
+	if len(p.Or) > 0 {
+		for _, sub := range p.Or {
+			if sub.Evaluate(slot, preimage) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// ClaimantArray is sql-json-serializable.
+type ClaimantArray []*Claimant
+
+func (cs ClaimantArray) Value() (driver.Value, error) {
+	bytes := util.CanonicalJSONEncode(cs)
+	return driver.Value(bytes), nil
+}
+
+func (cs *ClaimantArray) Scan(src interface{}) error {
+	bytes, ok := src.([]byte)
+	if !ok {
+		return errors.New("expected []byte")
+	}
+	return json.Unmarshal(bytes, cs)
+}
@@ -0,0 +1,96 @@
+package data
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"testing"
+
+	"github.com/lacker/coinkit/util"
+)
+
+func TestPredicateEvaluate(t *testing.T) {
+	secret := hex.EncodeToString([]byte("secret"))
+	hash := sha256.Sum256([]byte("secret"))
+	p := &Predicate{
+		Or: []*Predicate{
+			&Predicate{Before: 10, Hash: hex.EncodeToString(hash[:])},
+			&Predicate{After: 20},
+		},
+	}
+	if err := p.Check(); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		slot     int
+		preimage string
+		expected bool
+	}{
+		{5, secret, true},
+		{5, "", false},
+		{15, secret, false},
+		{20, "", true},
+	}
+	for _, c := range cases {
+		if p.Evaluate(c.slot, c.preimage) != c.expected {
+			t.Fatalf("expected %v for slot %d, preimage %q", c.expected, c.slot, c.preimage)
+		}
+	}
+}
+
+func TestClaimableBalanceProcessing(t *testing.T) {
+	alice := util.NewKeyPairFromSecretPhrase("alice").PublicKey().String()
+	bob := util.NewKeyPairFromSecretPhrase("bob").PublicKey().String()
+	c := NewCache()
+	c.Slot = 1
+	c.SetBalance(alice, 100)
+	c.SetBalance(bob, 0)
+
+	// Bob can claim before slot 10, and after that alice can take it back
+	err := c.Process(&CreateClaimableBalanceOperation{
+		Signer:   alice,
+		Sequence: 1,
+		Amount:   60,
+		Claimants: []*Claimant{
+			&Claimant{Destination: bob, Predicate: &Predicate{Before: 10}},
+			&Claimant{Destination: alice, Predicate: &Predicate{After: 10}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.GetAccount(alice).Balance != 40 || c.GetClaimableBalance(1) == nil || c.NextClaimID != 2 {
+		t.Fatalf("the money should be locked up")
+	}
+
+	if c.Validate(&ClaimOperation{Signer: alice, Sequence: 2, ID: 1}) == nil {
+		t.Fatalf("alice should not be able to reclaim the money yet")
+	}
+	c.Slot = 10
+	if c.Validate(&ClaimOperation{Signer: bob, Sequence: 1, ID: 1}) == nil {
+		t.Fatalf("bob should be too late")
+	}
+	err = c.Process(&ClaimOperation{Signer: alice, Sequence: 2, ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.GetAccount(alice).Balance != 100 || c.GetClaimableBalance(1) != nil {
+		t.Fatalf("alice should have the money back")
+	}
+}
+
+func TestClaimableBalanceOverflow(t *testing.T) {
+	alice := util.NewKeyPairFromSecretPhrase("alice").PublicKey().String()
+	c := NewCache()
+	c.SetBalance(alice, 1)
+	op := &CreateClaimableBalanceOperation{
+		Signer:    alice,
+		Sequence:  1,
+		Fee:       1,
+		Amount:    math.MaxUint64,
+		Claimants: []*Claimant{&Claimant{Destination: alice}},
+	}
+	if c.Process(op) == nil {
+		t.Fatalf("the amount and the fee should not be able to wrap around")
+	}
+}
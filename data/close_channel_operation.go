@@ -0,0 +1,73 @@
+package data
+
+import (
+	"fmt"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// CloseChannelOperation closes a payment channel.
+// When the recipient closes it, the update is the sender's promise, so the
+// channel pays out right away. An update from the sender is optional, since
+// the recipient can always close without being paid.
+// When the sender closes it, the channel can only be settled after the
+// dispute window. Until then, the recipient can close it with a later update.
+type CloseChannelOperation struct {
+	// The sender or the recipient of the channel
+	Signer string `json:"signer"`
+
+	// The sequence number for this operation
+	Sequence uint32 `json:"sequence"`
+
+	// How much the signer is willing to pay to send this operation through
+	Fee uint64 `json:"fee"`
+
+	// The slots this operation can be processed in
+	Validity
+
+	// The id of the channel
+	ID uint64 `json:"id"`
+
+	// The latest update. Nil means the recipient is paid nothing.
+	Update *ChannelUpdate `json:"update,omitempty"`
+}
+
+func (op *CloseChannelOperation) String() string {
+	return fmt.Sprintf("closechannel owner=%s, id=%d", util.Shorten(op.Signer), op.ID)
+}
+
+func (op *CloseChannelOperation) OperationType() string {
+	return "CloseChannel"
+}
+
+func (op *CloseChannelOperation) GetSigner() string {
+	return op.Signer
+}
+
+func (op *CloseChannelOperation) GetFee() uint64 {
+	return op.Fee
+}
+
+func (op *CloseChannelOperation) GetSequence() uint32 {
+	return op.Sequence
+}
+
+// Paid is how much the update pays the recipient.
+func (op *CloseChannelOperation) Paid() uint64 {
+	if op.Update == nil {
+		return 0
+	}
+	return op.Update.Paid
+}
+
+func (op *CloseChannelOperation) Verify() error {
+	if op.Update != nil && op.Update.Channel != op.ID {
+		return fmt.Errorf("the update is for channel %d, not channel %d",
+			op.Update.Channel, op.ID)
+	}
+	return nil
+}
+
+func init() {
+	RegisterOperationType(&CloseChannelOperation{})
+}
@@ -0,0 +1,87 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// CreateClaimableBalanceOperation locks up money so that it can only be
+// claimed by one of the claimants, when its predicate is true.
+// Making the signer one of the claimants lets the money be reclaimed, for
+// example after some slot.
+type CreateClaimableBalanceOperation struct {
+	// Whose money is locked up
+	Signer string `json:"signer"`
+
+	// The sequence number for this operation
+	Sequence uint32 `json:"sequence"`
+
+	// How much the signer is willing to pay to send this operation through
+	Fee uint64 `json:"fee"`
+
+	// The slots this operation can be processed in
+	Validity
+
+	// How much money to lock up
+	Amount uint64 `json:"amount"`
+
+	Claimants []*Claimant `json:"claimants"`
+}
+
+func (op *CreateClaimableBalanceOperation) String() string {
+	return fmt.Sprintf("createclaimable owner=%s, amount=%d, claimants=%d",
+		util.Shorten(op.Signer), op.Amount, len(op.Claimants))
+}
+
+func (op *CreateClaimableBalanceOperation) OperationType() string {
+	return "CreateClaimableBalance"
+}
+
+func (op *CreateClaimableBalanceOperation) GetSigner() string {
+	return op.Signer
+}
+
+func (op *CreateClaimableBalanceOperation) GetFee() uint64 {
+	return op.Fee
+}
+
+func (op *CreateClaimableBalanceOperation) GetSequence() uint32 {
+	return op.Sequence
+}
+
+func (op *CreateClaimableBalanceOperation) Verify() error {
+	if op.Amount == 0 {
+		return errors.New("cannot create an empty claimable balance")
+	}
+	if len(op.Claimants) == 0 {
+		return errors.New("a claimable balance needs at least one claimant")
+	}
+	if len(op.Claimants) > MaxClaimants {
+		return fmt.Errorf("a claimable balance can have at most %d claimants", MaxClaimants)
+	}
+	seen := make(map[string]bool)
+	for _, claimant := range op.Claimants {
+		if claimant == nil {
+			return errors.New("nil claimant")
+		}
+		if _, err := util.ReadPublicKey(claimant.Destination); err != nil {
+			return fmt.Errorf("invalid claimant: %s", claimant.Destination)
+		}
+		if seen[claimant.Destination] {
+			return fmt.Errorf("duplicate claimant: %s", claimant.Destination)
+		}
+		seen[claimant.Destination] = true
+		if claimant.Predicate != nil {
+			if err := claimant.Predicate.Check(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func init() {
+	RegisterOperationType(&CreateClaimableBalanceOperation{})
+}
@@ -17,6 +17,9 @@ type CreateDocumentOperation struct {
 	// How much the creator is willing to pay to get this document registered
 	Fee uint64 `json:"fee"`
 
+	// The slots this operation can be processed in
+	Validity
+
 	// The data to be created in the new document
 	Data *JSONObject `json:"data"`
 }
@@ -46,6 +49,9 @@ func (op *CreateDocumentOperation) GetData() *JSONObject {
 }
 
 func (op *CreateDocumentOperation) Verify() error {
+	if op.Data == nil {
+		return fmt.Errorf("document operations must have data")
+	}
 	return nil
 }
 
@@ -16,6 +16,9 @@ type CreateProviderOperation struct {
 	// The operation fee for entering an op into the blockchain
 	Fee uint64 `json:"fee"`
 
+	// The slots this operation can be processed in
+	Validity
+
 	// The capacity of the provider in megabytes
 	Capacity uint32 `json:"capacity"`
 }
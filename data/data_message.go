@@ -26,8 +26,36 @@ type DataMessage struct {
 	Buckets   []*Bucket   `json:"buckets"`
 	Providers []*Provider `json:"providers"`
 
+	// In response to an account query, the claimable balances that the
+	// account either locked up or can claim.
+	ClaimableBalances []*ClaimableBalance `json:"claimableBalances,omitempty"`
+
+	// In response to an account query, the payment channels that the account
+	// is the sender or recipient of.
+	Channels []*Channel `json:"channels,omitempty"`
+
+	// In response to an account query, the assets the account issued and
+	// the trustlines it holds.
+	Assets     []*Asset     `json:"assets,omitempty"`
+	Trustlines []*Trustline `json:"trustlines,omitempty"`
+
+	// In response to a payments query, the matching payments, most recent
+	// first.
+	Payments []*PaymentRecord `json:"payments,omitempty"`
+
 	// The contents of some committed operations, keyed by signature.
 	Operations map[string]*SignedOperation `json:"operations"`
+
+	// The base fee, in response to a fees query
+	BaseFee uint64 `json:"baseFee,omitempty"`
+
+	// The status of some operations, keyed by signature.
+	Statuses map[string]*OperationStatus `json:"statuses,omitempty"`
+
+	// Operations that are waiting in the queue, highest fee first, and
+	// statistics about the whole queue.
+	Pending    []*SignedOperation `json:"pending,omitempty"`
+	QueueStats *QueueStats        `json:"queueStats,omitempty"`
 }
 
 func (m *DataMessage) Slot() int {
@@ -89,6 +89,11 @@ func NewDatabase(config *Config) *Database {
 		postgres.Exec("DELETE FROM buckets")
 		postgres.Exec("DELETE FROM providers")
 		postgres.Exec("DELETE FROM allocations")
+		postgres.Exec("DELETE FROM claimables")
+		postgres.Exec("DELETE FROM channels")
+		postgres.Exec("DELETE FROM payments")
+		postgres.Exec("DELETE FROM assets")
+		postgres.Exec("DELETE FROM trustlines")
 	}
 
 	db := &Database{
@@ -125,9 +130,14 @@ CREATE UNIQUE INDEX IF NOT EXISTS block_slot_idx ON blocks (slot);
 CREATE TABLE IF NOT EXISTS accounts (
     owner text,
     sequence integer CHECK (sequence >= 0),
-    balance bigint CHECK (balance >= 0)
+    balance bigint CHECK (balance >= 0),
+    auth json,
+    delegates json
 );
 
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS auth json;
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS delegates json;
+
 CREATE UNIQUE INDEX IF NOT EXISTS account_owner_idx ON accounts (owner);
 
 CREATE TABLE IF NOT EXISTS documents (
@@ -161,6 +171,64 @@ CREATE TABLE IF NOT EXISTS providers (
 CREATE UNIQUE INDEX IF NOT EXISTS provider_id_idx ON providers (id);
 CREATE INDEX IF NOT EXISTS provider_owner_idx ON providers (owner);
 CREATE INDEX IF NOT EXISTS provider_bucket_idx ON providers (buckets);
+
+CREATE TABLE IF NOT EXISTS claimables (
+    id bigint,
+    owner text,
+    amount bigint CHECK (amount >= 0),
+    claimants jsonb NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS claimable_id_idx ON claimables (id);
+CREATE INDEX IF NOT EXISTS claimable_owner_idx ON claimables (owner);
+CREATE INDEX IF NOT EXISTS claimable_claimants_idx ON claimables USING gin (claimants jsonb_path_ops);
+
+CREATE TABLE IF NOT EXISTS channels (
+    id bigint,
+    sender text,
+    recipient text,
+    amount bigint CHECK (amount >= 0),
+    disputewindow integer,
+    closingslot integer,
+    closingpaid bigint
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS channel_id_idx ON channels (id);
+CREATE INDEX IF NOT EXISTS channel_sender_idx ON channels (sender);
+CREATE INDEX IF NOT EXISTS channel_recipient_idx ON channels (recipient);
+
+CREATE TABLE IF NOT EXISTS payments (
+    slot integer,
+    sender text,
+    recipient text,
+    amount bigint CHECK (amount >= 0),
+    memo jsonb
+);
+
+CREATE INDEX IF NOT EXISTS payment_recipient_idx ON payments (recipient, slot);
+CREATE INDEX IF NOT EXISTS payment_memo_idx ON payments USING gin (memo jsonb_path_ops);
+
+CREATE TABLE IF NOT EXISTS assets (
+    code text,
+    issuer text,
+    authrequired boolean,
+    revocable boolean,
+    supply bigint CHECK (supply >= 0)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS asset_key_idx ON assets (issuer, code);
+
+CREATE TABLE IF NOT EXISTS trustlines (
+    owner text,
+    issuer text,
+    code text,
+    balance bigint CHECK (balance >= 0),
+    "limit" bigint CHECK ("limit" >= 0),
+    authorized boolean
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS trustline_key_idx ON trustlines (owner, issuer, code);
+CREATE INDEX IF NOT EXISTS trustline_asset_idx ON trustlines (issuer, code);
 `
 
 // Not threadsafe, caller should hold mutex or be in init
@@ -259,7 +327,9 @@ func (db *Database) Commit() {
 	if db.tx == nil {
 		return
 	}
+	start := time.Now()
 	check(db.tx.Commit())
+	dbCommitSeconds.Observe(time.Since(start).Seconds())
 	db.tx = nil
 	db.commits++
 	db.updateCurrentSlot()
@@ -316,6 +386,10 @@ func (db *Database) HandleQueryMessage(m *QueryMessage) (*DataMessage, error) {
 	if m == nil {
 		return nil, fmt.Errorf("nil is not a valid query message")
 	}
+	start := time.Now()
+	defer func() {
+		dbQuerySeconds.Observe(time.Since(start).Seconds(), m.QueryType())
+	}()
 
 	if m.Account != "" {
 		return db.AccountDataMessage(m.Account), nil
@@ -341,6 +415,14 @@ func (db *Database) HandleQueryMessage(m *QueryMessage) (*DataMessage, error) {
 		return db.ProviderDataMessage(m.Providers), nil
 	}
 
+	if m.Payments != nil {
+		return db.PaymentDataMessage(m.Payments)
+	}
+
+	if m.Fees {
+		return db.FeesDataMessage(), nil
+	}
+
 	return nil, fmt.Errorf("query message does not contain any recognizable fields")
 }
 
@@ -376,6 +458,17 @@ func (db *Database) finishReadTransaction(tx *sqlx.Tx) {
 	db.reads++
 }
 
+// FeesDataMessage reports the base fee after the last finalized block.
+func (db *Database) FeesDataMessage() *DataMessage {
+	answer := &DataMessage{}
+	block := db.LastBlock()
+	if block != nil {
+		answer.I = block.Slot
+		answer.BaseFee = block.Chunk.BaseFee
+	}
+	return answer
+}
+
 func (db *Database) AccountDataMessage(owner string) *DataMessage {
 	tx, slot := db.readTransaction()
 
@@ -387,11 +480,41 @@ func (db *Database) AccountDataMessage(owner string) *DataMessage {
 		check(err)
 	}
 
+	// The claimable balances this account locked up, or can claim
+	claimables := []*ClaimableBalance{}
+	claimant := util.CanonicalJSONEncode([]*Claimant{&Claimant{Destination: owner}})
+	err = tx.Select(&claimables,
+		"SELECT * FROM claimables WHERE owner=$1 OR claimants @> $2 ORDER BY id LIMIT $3",
+		owner, string(claimant), boundLimit(0))
+	check(err)
+
+	channels := []*Channel{}
+	err = tx.Select(&channels,
+		"SELECT * FROM channels WHERE sender=$1 OR recipient=$1 ORDER BY id LIMIT $2",
+		owner, boundLimit(0))
+	check(err)
+
+	assets := []*Asset{}
+	err = tx.Select(&assets,
+		"SELECT * FROM assets WHERE issuer=$1 ORDER BY code LIMIT $2",
+		owner, boundLimit(0))
+	check(err)
+
+	trustlines := []*Trustline{}
+	err = tx.Select(&trustlines,
+		"SELECT * FROM trustlines WHERE owner=$1 ORDER BY code, issuer LIMIT $2",
+		owner, boundLimit(0))
+	check(err)
+
 	db.finishReadTransaction(tx)
 
 	return &DataMessage{
-		I:        slot,
-		Accounts: map[string]*Account{owner: account},
+		I:                 slot,
+		Accounts:          map[string]*Account{owner: account},
+		ClaimableBalances: claimables,
+		Channels:          channels,
+		Assets:            assets,
+		Trustlines:        trustlines,
 	}
 }
 
@@ -435,6 +558,18 @@ func (db *Database) ProviderDataMessage(q *ProviderQuery) *DataMessage {
 	return message
 }
 
+func (db *Database) PaymentDataMessage(q *PaymentQuery) (*DataMessage, error) {
+	if q.Recipient == "" {
+		return nil, fmt.Errorf("a payments query needs a recipient")
+	}
+	payments, slot := db.GetPayments(q)
+	message := &DataMessage{
+		Payments: payments,
+		I:        slot,
+	}
+	return message, nil
+}
+
 // Currently just checks the last 20 blocks for the right operation.
 // TODO: store ops by signature somewhere
 func (db *Database) SignatureDataMessage(signature string) *DataMessage {
@@ -454,6 +589,45 @@ func (db *Database) SignatureDataMessage(signature string) *DataMessage {
 	return answer
 }
 
+// FinalizedStatus looks for an operation in the same recent blocks that
+// SignatureDataMessage checks. It returns nil if the operation is not there.
+func (db *Database) FinalizedStatus(signature string) *OperationStatus {
+	for _, block := range db.TailBlocks(20) {
+		if block.GetOperation(signature) != nil {
+			return &OperationStatus{
+				Signature: signature,
+				State:     StatusFinalized,
+				Slot:      block.Slot,
+			}
+		}
+	}
+	return nil
+}
+
+// AwaitDataMessage returns the current data for an AwaitMessage, and whether
+// the wait is over. It returns an error if the awaited operation was rejected.
+func (db *Database) AwaitDataMessage(m *AwaitMessage) (*DataMessage, bool, error) {
+	answer := &DataMessage{}
+	var account *Account
+	if m.Account != "" {
+		// The account must be read first. Otherwise, a block could be
+		// finalized in between, and we would think its operation was rejected.
+		answer = db.AccountDataMessage(m.Account)
+		account = answer.Accounts[m.Account]
+	}
+	var op *SignedOperation
+	if m.Signature != "" {
+		sdm := db.SignatureDataMessage(m.Signature)
+		op = sdm.Operations[m.Signature]
+		answer.Operations = sdm.Operations
+		if sdm.I > answer.I {
+			answer.I = sdm.I
+		}
+	}
+	done, err := m.Check(account, op)
+	return answer, done, err
+}
+
 // CheckBlockReplay replays the blockchain from the beginning
 // and returns an error if the result conflicts with the data held in our database.
 func (db *Database) CheckBlockReplay() error {
@@ -464,6 +638,7 @@ func (db *Database) CheckBlockReplay() error {
 	var err error
 	db.ForBlocks(func(b *Block) {
 		if err == nil {
+			cache.Slot = b.Slot
 			err = cache.ProcessChunk(b.Chunk)
 		}
 	})
@@ -580,11 +755,13 @@ func (db *Database) ForBlocks(f func(b *Block)) int {
 //////////////
 
 const accountUpsert = `
-INSERT INTO accounts (owner, sequence, balance)
-VALUES (:owner, :sequence, :balance)
+INSERT INTO accounts (owner, sequence, balance, auth, delegates)
+VALUES (:owner, :sequence, :balance, :auth, :delegates)
 ON CONFLICT (owner) DO UPDATE
   SET sequence = EXCLUDED.sequence,
-      balance = EXCLUDED.balance;
+      balance = EXCLUDED.balance,
+      auth = EXCLUDED.auth,
+      delegates = EXCLUDED.delegates;
 `
 
 // Database.UpsertAccount will not finalize until Commit is called.
@@ -1164,3 +1341,220 @@ func (db *Database) Deallocate(bucketName string, providerID uint64) error {
 
 	return nil
 }
+
+///////////////////////
+// Claimable balances
+///////////////////////
+
+const claimableInsert = `
+INSERT INTO claimables (id, owner, amount, claimants)
+VALUES (:id, :owner, :amount, :claimants)
+`
+
+// InsertClaimableBalance returns an error if it failed because there is
+// already a claimable balance with this id.
+// It uses the transaction.
+// It panics if there is a fundamental database problem.
+// If this returns an error, the pending transaction will be unusable.
+func (db *Database) InsertClaimableBalance(b *ClaimableBalance) error {
+	_, err := db.namedExecTx(claimableInsert, b)
+	if isUniquenessError(err) {
+		return err
+	}
+	check(err)
+	return nil
+}
+
+// DeleteClaimableBalance deletes the claimable balance, using the transaction.
+// It errors when there is no such claimable balance.
+// If this returns an error, the pending transaction will still be usable.
+func (db *Database) DeleteClaimableBalance(id uint64) error {
+	res, err := db.execTx("DELETE FROM claimables WHERE id = $1", id)
+	check(err)
+	count, err := res.RowsAffected()
+	check(err)
+	if count != 1 {
+		return fmt.Errorf("expected 1 claimable balance deleted, got %d", count)
+	}
+	return nil
+}
+
+// GetClaimableBalance returns nil if there is no claimable balance with this id.
+func (db *Database) GetClaimableBalance(id uint64) *ClaimableBalance {
+	answer := &ClaimableBalance{}
+	err := db.postgres.Get(answer, "SELECT * FROM claimables WHERE id=$1", id)
+	db.reads++
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	check(err)
+	return answer
+}
+
+//////////////
+// Channels
+//////////////
+
+const channelUpsert = `
+INSERT INTO channels (id, sender, recipient, amount, disputewindow, closingslot, closingpaid)
+VALUES (:id, :sender, :recipient, :amount, :disputewindow, :closingslot, :closingpaid)
+ON CONFLICT (id) DO UPDATE
+  SET closingslot = EXCLUDED.closingslot,
+      closingpaid = EXCLUDED.closingpaid;
+`
+
+// UpsertChannel uses the transaction.
+// Only the closing state of an existing channel can change.
+func (db *Database) UpsertChannel(ch *Channel) error {
+	_, err := db.namedExecTx(channelUpsert, ch)
+	check(err)
+	return nil
+}
+
+// DeleteChannel deletes the channel, using the transaction.
+// It errors when there is no such channel.
+// If this returns an error, the pending transaction will still be usable.
+func (db *Database) DeleteChannel(id uint64) error {
+	res, err := db.execTx("DELETE FROM channels WHERE id = $1", id)
+	check(err)
+	count, err := res.RowsAffected()
+	check(err)
+	if count != 1 {
+		return fmt.Errorf("expected 1 channel deleted, got %d", count)
+	}
+	return nil
+}
+
+// GetChannel returns nil if there is no channel with this id.
+func (db *Database) GetChannel(id uint64) *Channel {
+	answer := &Channel{}
+	err := db.postgres.Get(answer, "SELECT * FROM channels WHERE id=$1", id)
+	db.reads++
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	check(err)
+	return answer
+}
+
+//////////////
+// Payments
+//////////////
+
+const paymentInsert = `
+INSERT INTO payments (slot, sender, recipient, amount, memo)
+VALUES (:slot, :sender, :recipient, :amount, :memo)
+`
+
+// InsertPayment adds a payment to the payments index, using the transaction.
+// It panics if there is a fundamental database problem.
+func (db *Database) InsertPayment(r *PaymentRecord) error {
+	_, err := db.namedExecTx(paymentInsert, r)
+	check(err)
+	return nil
+}
+
+// GetPayments returns the payments matching a query, most recent first, along
+// with the slot that this data reflects.
+func (db *Database) GetPayments(q *PaymentQuery) ([]*PaymentRecord, int) {
+	limit := boundLimit(q.Limit)
+	tx, slot := db.readTransaction()
+
+	payments := []*PaymentRecord{}
+	var err error
+	if q.Memo == nil {
+		err = tx.Select(&payments,
+			"SELECT * FROM payments WHERE recipient=$1 ORDER BY slot DESC LIMIT $2",
+			q.Recipient, limit)
+	} else {
+		err = tx.Select(&payments,
+			"SELECT * FROM payments WHERE recipient=$1 AND memo @> $2 ORDER BY slot DESC LIMIT $3",
+			q.Recipient, string(util.CanonicalJSONEncode(q.Memo)), limit)
+	}
+	check(err)
+
+	db.finishReadTransaction(tx)
+	return payments, slot
+}
+
+//////////////
+// Assets
+//////////////
+
+const assetUpsert = `
+INSERT INTO assets (code, issuer, authrequired, revocable, supply)
+VALUES (:code, :issuer, :authrequired, :revocable, :supply)
+ON CONFLICT (issuer, code) DO UPDATE
+  SET supply = EXCLUDED.supply;
+`
+
+// UpsertAsset uses the transaction.
+// Only the supply of an existing asset can change.
+func (db *Database) UpsertAsset(a *Asset) error {
+	_, err := db.namedExecTx(assetUpsert, a)
+	check(err)
+	return nil
+}
+
+// GetAsset returns nil if there is no such asset.
+func (db *Database) GetAsset(issuer string, code string) *Asset {
+	answer := &Asset{}
+	err := db.postgres.Get(answer,
+		"SELECT * FROM assets WHERE issuer=$1 AND code=$2", issuer, code)
+	db.reads++
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	check(err)
+	return answer
+}
+
+//////////////
+// Trustlines
+//////////////
+
+const trustlineUpsert = `
+INSERT INTO trustlines (owner, issuer, code, balance, "limit", authorized)
+VALUES (:owner, :issuer, :code, :balance, :limit, :authorized)
+ON CONFLICT (owner, issuer, code) DO UPDATE
+  SET balance = EXCLUDED.balance,
+      "limit" = EXCLUDED."limit",
+      authorized = EXCLUDED.authorized;
+`
+
+// UpsertTrustline uses the transaction.
+func (db *Database) UpsertTrustline(t *Trustline) error {
+	_, err := db.namedExecTx(trustlineUpsert, t)
+	check(err)
+	return nil
+}
+
+// DeleteTrustline deletes the trustline, using the transaction.
+// It errors when there is no such trustline.
+// If this returns an error, the pending transaction will still be usable.
+func (db *Database) DeleteTrustline(owner string, issuer string, code string) error {
+	res, err := db.execTx(
+		"DELETE FROM trustlines WHERE owner = $1 AND issuer = $2 AND code = $3",
+		owner, issuer, code)
+	check(err)
+	count, err := res.RowsAffected()
+	check(err)
+	if count != 1 {
+		return fmt.Errorf("expected 1 trustline deleted, got %d", count)
+	}
+	return nil
+}
+
+// GetTrustline returns nil if there is no such trustline.
+func (db *Database) GetTrustline(owner string, issuer string, code string) *Trustline {
+	answer := &Trustline{}
+	err := db.postgres.Get(answer,
+		"SELECT * FROM trustlines WHERE owner=$1 AND issuer=$2 AND code=$3",
+		owner, issuer, code)
+	db.reads++
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	check(err)
+	return answer
+}
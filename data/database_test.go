@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/lacker/coinkit/consensus"
+	"github.com/lacker/coinkit/util"
 )
 
 func TestInsertAndGet(t *testing.T) {
@@ -129,6 +130,14 @@ func TestLastBlock(t *testing.T) {
 	if op == nil || sop.Signature != op.Signature {
 		t.Fatalf("got bad op in data message: %+v", dm)
 	}
+	// The database can tell that the op was finalized
+	status := db.FinalizedStatus(op.Signature)
+	if status == nil || status.State != StatusFinalized || status.Slot != 1 {
+		t.Fatalf("got bad status: %+v", status)
+	}
+	if db.FinalizedStatus("nonexistent") != nil {
+		t.Fatalf("an unknown op should not be finalized")
+	}
 }
 
 func TestForBlocks(t *testing.T) {
@@ -667,3 +676,46 @@ func TestProviders(t *testing.T) {
 		t.Fatalf("failed to HandleQueryMessage: %+v", qm)
 	}
 }
+
+func TestPayments(t *testing.T) {
+	db := NewTestDatabase(0)
+	c := NewDatabaseCache(db, 1, 1)
+	sender := util.NewKeyPairFromSecretPhrase("payment sender").PublicKey().String()
+	recipient := util.NewKeyPairFromSecretPhrase("payment recipient").PublicKey().String()
+	c.SetBalance(sender, 100)
+	memos := []*Memo{&Memo{ID: 1}, nil, &Memo{ID: 1}}
+	for i, memo := range memos {
+		c.Slot = i + 1
+		err := c.Process(&SendOperation{
+			Signer:   sender,
+			Sequence: uint32(i + 1),
+			To:       recipient,
+			Amount:   uint64(i + 1),
+			Memo:     memo,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Commit()
+
+	dm, err := db.HandleQueryMessage(&QueryMessage{
+		Payments: &PaymentQuery{Recipient: recipient},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dm.Payments) != 3 || dm.Payments[0].Slot != 3 || dm.Payments[0].Sender != sender {
+		t.Fatalf("unexpected payments: %+v", dm.Payments)
+	}
+
+	dm, err = db.HandleQueryMessage(&QueryMessage{
+		Payments: &PaymentQuery{Recipient: recipient, Memo: &Memo{ID: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dm.Payments) != 2 || dm.Payments[1].Amount != 1 {
+		t.Fatalf("unexpected payments with memo: %+v", dm.Payments)
+	}
+}
@@ -16,6 +16,9 @@ type DeallocateOperation struct {
 	// The operation fee for entering an op into the blockchain
 	Fee uint64 `json:"fee"`
 
+	// The slots this operation can be processed in
+	Validity
+
 	// The name of the bucket
 	BucketName string `json:"bucketName"`
 
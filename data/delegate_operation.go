@@ -0,0 +1,76 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// DelegateOperation lets another key act for an account, within a limited
+// scope, or takes that permission away.
+// This is how an app can get permission to do some things for a user without
+// holding the user's own key.
+type DelegateOperation struct {
+	// Whose account the delegate can act for
+	Signer string `json:"signer"`
+
+	// The sequence number for this operation
+	Sequence uint32 `json:"sequence"`
+
+	// How much the signer is willing to pay to send this operation through
+	Fee uint64 `json:"fee"`
+
+	// The slots this operation can be processed in
+	Validity
+
+	// The public key of the delegate
+	Delegate string `json:"delegate"`
+
+	// What the delegate can do. Nil removes the delegate.
+	// Granting a scope to an existing delegate replaces its old scope and
+	// resets its spending.
+	Scope *DelegateScope `json:"scope"`
+}
+
+func (op *DelegateOperation) String() string {
+	if op.Scope == nil {
+		return fmt.Sprintf("undelegate owner=%s, delegate=%s",
+			util.Shorten(op.Signer), util.Shorten(op.Delegate))
+	}
+	return fmt.Sprintf("delegate owner=%s, delegate=%s, %s",
+		util.Shorten(op.Signer), util.Shorten(op.Delegate), op.Scope)
+}
+
+func (op *DelegateOperation) OperationType() string {
+	return "Delegate"
+}
+
+func (op *DelegateOperation) GetSigner() string {
+	return op.Signer
+}
+
+func (op *DelegateOperation) GetFee() uint64 {
+	return op.Fee
+}
+
+func (op *DelegateOperation) GetSequence() uint32 {
+	return op.Sequence
+}
+
+func (op *DelegateOperation) Verify() error {
+	if _, err := util.ReadPublicKey(op.Delegate); err != nil {
+		return fmt.Errorf("invalid delegate key: %s", op.Delegate)
+	}
+	if op.Delegate == op.Signer {
+		return errors.New("an account cannot delegate to itself")
+	}
+	if op.Scope == nil {
+		return nil
+	}
+	return op.Scope.Check()
+}
+
+func init() {
+	RegisterOperationType(&DelegateOperation{})
+}
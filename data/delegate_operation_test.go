@@ -0,0 +1,86 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/lacker/coinkit/util"
+)
+
+func TestDelegateScope(t *testing.T) {
+	owner := util.NewKeyPairFromSecretPhrase("owner")
+	app := util.NewKeyPairFromSecretPhrase("app")
+	bob := util.NewKeyPairFromSecretPhrase("bob").PublicKey().String()
+	c := NewCache()
+	c.Slot = 1
+	c.SetBalance(owner.PublicKey().String(), 100)
+
+	err := c.ProcessSigned(NewSignedOperation(&DelegateOperation{
+		Signer:   owner.PublicKey().String(),
+		Sequence: 1,
+		Delegate: app.PublicKey().String(),
+		Scope: &DelegateScope{
+			Documents: true,
+			Allowance: 10,
+			Period:    5,
+			Expiry:    20,
+		},
+	}, owner))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sequence := uint32(2)
+	act := func(op Operation) error {
+		err := c.ProcessSigned(NewSignedOperationWithKey(op, app))
+		if err == nil {
+			sequence++
+		}
+		return err
+	}
+	send := func(amount uint64) error {
+		return act(&SendOperation{
+			Signer:   owner.PublicKey().String(),
+			Sequence: sequence,
+			To:       bob,
+			Amount:   amount,
+		})
+	}
+
+	data := NewEmptyJSONObject()
+	data.Set("foo", 1)
+	err = act(&CreateDocumentOperation{
+		Signer:   owner.PublicKey().String(),
+		Sequence: sequence,
+		Fee:      1,
+		Data:     data,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := send(9); err != nil {
+		t.Fatal(err)
+	}
+	if send(1) == nil {
+		t.Fatalf("the delegate should be out of allowance")
+	}
+	err = act(&SetSignersOperation{
+		Signer:   owner.PublicKey().String(),
+		Sequence: sequence,
+	})
+	if err == nil {
+		t.Fatalf("a delegate should not be able to change signers")
+	}
+
+	// The allowance resets in the next period
+	c.Slot = 7
+	if err := send(5); err != nil {
+		t.Fatal(err)
+	}
+	c.Slot = 21
+	if send(1) == nil {
+		t.Fatalf("the delegate should have expired")
+	}
+	if c.GetAccount(bob).Balance != 14 || c.GetAccount(owner.PublicKey().String()).Balance != 85 {
+		t.Fatalf("unexpected balances")
+	}
+}
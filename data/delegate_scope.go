@@ -0,0 +1,182 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// MaxDelegates is the most delegate keys a single account can have.
+const MaxDelegates = 20
+
+// A DelegateScope limits what a delegate key can do for an account.
+// A delegate can never change the account's signers or delegates.
+type DelegateScope struct {
+	// When set, the delegate can create, update and delete documents
+	Documents bool `json:"documents,omitempty"`
+
+	// When nonempty, the delegate can update, allocate, deallocate and delete
+	// the bucket with this name
+	Bucket string `json:"bucket,omitempty"`
+
+	// How much money the delegate can spend per period, counting both fees
+	// and sends. A delegate that is only meant to manage documents still
+	// needs an allowance to pay fees.
+	Allowance uint64 `json:"allowance,omitempty"`
+
+	// How many slots a spending period lasts. Zero means the allowance never
+	// resets.
+	Period int `json:"period,omitempty"`
+
+	// The last slot in which the delegate can act. Zero means the delegate
+	// never expires.
+	Expiry int `json:"expiry,omitempty"`
+
+	// How much the delegate has spent in the period that started at
+	// PeriodStart. These are kept up to date by the cache.
+	Spent       uint64 `json:"spent,omitempty"`
+	PeriodStart int    `json:"periodStart,omitempty"`
+}
+
+func (s *DelegateScope) String() string {
+	parts := []string{}
+	if s.Documents {
+		parts = append(parts, "documents")
+	}
+	if s.Bucket != "" {
+		parts = append(parts, fmt.Sprintf("bucket=%s", s.Bucket))
+	}
+	parts = append(parts, fmt.Sprintf("allowance=%d/%d", s.Allowance, s.Period))
+	if s.Expiry != 0 {
+		parts = append(parts, fmt.Sprintf("expiry=%d", s.Expiry))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Check returns an error if this is not a sensible scope to grant.
+func (s *DelegateScope) Check() error {
+	if s.Period < 0 || s.Expiry < 0 {
+		return errors.New("delegate periods and expiry slots cannot be negative")
+	}
+	if s.Bucket != "" && !IsValidBucketName(s.Bucket) {
+		return fmt.Errorf("invalid bucket name: %s", s.Bucket)
+	}
+	if s.Spent != 0 || s.PeriodStart != 0 {
+		return errors.New("a new delegate scope cannot have spending history")
+	}
+	return nil
+}
+
+// spentAt returns how much the delegate has spent in the period that
+// includes this slot.
+func (s *DelegateScope) spentAt(slot int) uint64 {
+	if s.Period > 0 && slot >= s.PeriodStart+s.Period {
+		return 0
+	}
+	return s.Spent
+}
+
+// Permits returns an error unless the delegate can do this operation in
+// this slot.
+func (s *DelegateScope) Permits(op Operation, slot int) error {
+	if s.Expiry != 0 && slot > s.Expiry {
+		return fmt.Errorf("the delegate expired at slot %d", s.Expiry)
+	}
+
+	allowed := false
+	switch op := op.(type) {
+	case *SendOperation, *MultiSendOperation:
+		allowed = true
+	case *CreateDocumentOperation, *UpdateDocumentOperation, *DeleteDocumentOperation:
+		allowed = s.Documents
+	case *UpdateBucketOperation:
+		allowed = s.Bucket != "" && op.Name == s.Bucket
+	case *DeleteBucketOperation:
+		allowed = s.Bucket != "" && op.Name == s.Bucket
+	case *AllocateOperation:
+		allowed = s.Bucket != "" && op.BucketName == s.Bucket
+	case *DeallocateOperation:
+		allowed = s.Bucket != "" && op.BucketName == s.Bucket
+	}
+	if !allowed {
+		return fmt.Errorf("the delegate is not allowed to %s", op.OperationType())
+	}
+
+	if s.spentAt(slot)+delegateCost(op) > s.Allowance {
+		return fmt.Errorf("the delegate only has %d left to spend",
+			s.Allowance-s.spentAt(slot))
+	}
+	return nil
+}
+
+// Charge returns a copy of the scope with the cost of an operation spent.
+func (s *DelegateScope) Charge(op Operation, slot int) *DelegateScope {
+	answer := *s
+	answer.Spent = s.spentAt(slot) + delegateCost(op)
+	if s.Period > 0 && slot >= s.PeriodStart+s.Period {
+		answer.PeriodStart = slot
+	}
+	return &answer
+}
+
+// delegateCost is how much of a delegate's allowance an operation uses up.
+func delegateCost(op Operation) uint64 {
+	switch op := op.(type) {
+	case *SendOperation:
+		return op.Amount + op.Fee
+	case *MultiSendOperation:
+		return op.Total() + op.Fee
+	default:
+		return op.GetFee()
+	}
+}
+
+// DelegateMap maps the public key of each delegate to its scope.
+// DelegateMap is sql-json-serializable.
+type DelegateMap map[string]*DelegateScope
+
+func (m DelegateMap) Equal(other DelegateMap) bool {
+	if len(m) == 0 || len(other) == 0 {
+		return len(m) == len(other)
+	}
+	return string(util.CanonicalJSONEncode(m)) == string(util.CanonicalJSONEncode(other))
+}
+
+func (m DelegateMap) String() string {
+	keys := []string{}
+	for key, _ := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := []string{}
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=(%s)", util.Shorten(key), m[key]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// An empty DelegateMap is stored as null.
+func (m DelegateMap) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	bytes := util.CanonicalJSONEncode(m)
+	return driver.Value(bytes), nil
+}
+
+func (m *DelegateMap) Scan(src interface{}) error {
+	if src == nil {
+		*m = nil
+		return nil
+	}
+	bytes, ok := src.([]byte)
+	if !ok {
+		return errors.New("expected []byte")
+	}
+	return json.Unmarshal(bytes, m)
+}
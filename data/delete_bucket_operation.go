@@ -16,6 +16,9 @@ type DeleteBucketOperation struct {
 	// The operation fee for entering an op into the blockchain
 	Fee uint64 `json:"fee"`
 
+	// The slots this operation can be processed in
+	Validity
+
 	// The name of the bucket
 	Name string `json:"name"`
 }
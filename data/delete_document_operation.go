@@ -16,6 +16,9 @@ type DeleteDocumentOperation struct {
 	// How much the updater is willing to pay to send this operation through
 	Fee uint64 `json:"fee"`
 
+	// The slots this operation can be processed in
+	Validity
+
 	// The id of the document to update
 	ID uint64 `json:"id"`
 }
@@ -16,6 +16,9 @@ type DeleteProviderOperation struct {
 	// The operation fee for entering an op into the blockchain
 	Fee uint64 `json:"fee"`
 
+	// The slots this operation can be processed in
+	Validity
+
 	// The id of the provider to delete
 	ID uint64 `json:"id"`
 }
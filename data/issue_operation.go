@@ -0,0 +1,87 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// IssueOperation creates an asset, or issues more of it to a trustline.
+// The first IssueOperation for a code creates the asset with its flags, and
+// the flags cannot be changed after that.
+// Issuing to a trustline also authorizes it, so for assets that require
+// authorization, issuing an amount of zero just authorizes.
+type IssueOperation struct {
+	// Who is issuing the asset
+	Signer string `json:"signer"`
+
+	// The sequence number for this operation
+	Sequence uint32 `json:"sequence"`
+
+	// How much the signer is willing to pay to send this operation through
+	Fee uint64 `json:"fee"`
+
+	// The slots this operation can be processed in
+	Validity
+
+	// The code for the asset
+	Code string `json:"code"`
+
+	// The flags for the asset
+	AuthRequired bool `json:"authRequired,omitempty"`
+	Revocable    bool `json:"revocable,omitempty"`
+
+	// Who to issue to, and how much. Empty to just create the asset.
+	To     string `json:"to,omitempty"`
+	Amount uint64 `json:"amount,omitempty"`
+}
+
+func (op *IssueOperation) String() string {
+	return fmt.Sprintf("issue %d %s from %s -> %s, seq %d fee %d",
+		op.Amount, op.Code, util.Shorten(op.Signer), util.Shorten(op.To), op.Sequence, op.Fee)
+}
+
+func (op *IssueOperation) OperationType() string {
+	return "Issue"
+}
+
+func (op *IssueOperation) GetSigner() string {
+	return op.Signer
+}
+
+func (op *IssueOperation) GetFee() uint64 {
+	return op.Fee
+}
+
+func (op *IssueOperation) GetSequence() uint32 {
+	return op.Sequence
+}
+
+func (op *IssueOperation) Verify() error {
+	if !IsValidAssetCode(op.Code) {
+		return fmt.Errorf("invalid asset code: %s", op.Code)
+	}
+	if op.To == "" {
+		if op.Amount != 0 {
+			return errors.New("cannot issue an amount without a recipient")
+		}
+		return nil
+	}
+	if _, err := util.ReadPublicKey(op.To); err != nil {
+		return fmt.Errorf("cannot issue to invalid public key: %s", op.To)
+	}
+	if op.To == op.Signer {
+		return errors.New("an issuer cannot issue to itself")
+	}
+	// The database stores amounts as signed 64-bit integers
+	if op.Amount > math.MaxInt64 {
+		return fmt.Errorf("cannot issue more than %d at once", int64(math.MaxInt64))
+	}
+	return nil
+}
+
+func init() {
+	RegisterOperationType(&IssueOperation{})
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"sort"
 
 	"github.com/lacker/coinkit/consensus"
@@ -19,16 +20,32 @@ const MaxChunkSize = 100
 // LedgerChunk is sql-json-serializable.
 type LedgerChunk struct {
 	// The state of accounts after these operations have been processed.
-	// This only includes account information for the accounts that are
-	// mentioned in the operations.
+	// This only includes the accounts that the operations changed, which
+	// can be accounts that no operation mentions directly, like the other
+	// side of a channel that a settlement pays out to.
 	Accounts map[string]*Account `json:"accounts"`
 
+	// The state of the assets and trustlines that these operations changed,
+	// keyed by asset key and trustline key.
+	// A nil trustline was removed.
+	Assets     map[string]*Asset     `json:"assets,omitempty"`
+	Trustlines map[string]*Trustline `json:"trustlines,omitempty"`
+
 	// The id for the next document to be created, after this chunk
 	NextDocumentID uint64 `json:"nextDocumentID"`
 
 	// The id for the next provider to be created, after this chunk
 	NextProviderID uint64 `json:"nextProviderID"`
 
+	// The id for the next claimable balance to be created, after this chunk
+	NextClaimID uint64 `json:"nextClaimID,omitempty"`
+
+	// The id for the next payment channel to be opened, after this chunk
+	NextChannelID uint64 `json:"nextChannelID,omitempty"`
+
+	// The base fee for operations, after this chunk
+	BaseFee uint64 `json:"baseFee,omitempty"`
+
 	Operations []*SignedOperation `json:"operations"`
 }
 
@@ -39,6 +56,7 @@ func (c *LedgerChunk) Hash() consensus.SlotValue {
 	h := sha512.New512_256()
 	for _, op := range c.Operations {
 		h.Write([]byte(op.Signature))
+		h.Write(op.cosignatureBytes())
 	}
 	keys := []string{}
 	for key, _ := range c.Accounts {
@@ -50,6 +68,30 @@ func (c *LedgerChunk) Hash() consensus.SlotValue {
 		account := c.Accounts[key]
 		h.Write(account.Bytes())
 	}
+	// Assets and trustlines are only hashed when there are some, so that
+	// older chunks keep their hashes
+	keys = []string{}
+	for key, _ := range c.Assets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		h.Write([]byte("asset:" + key))
+		h.Write(util.CanonicalJSONEncode(c.Assets[key]))
+	}
+	keys = []string{}
+	for key, _ := range c.Trustlines {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		h.Write([]byte("trustline:" + key))
+		h.Write(util.CanonicalJSONEncode(c.Trustlines[key]))
+	}
+	if c.BaseFee != 0 {
+		// Only hashed when nonzero, so that older chunks keep their hashes
+		h.Write([]byte(fmt.Sprintf("baseFee:%d", c.BaseFee)))
+	}
 	return consensus.SlotValue(base64.RawStdEncoding.EncodeToString(h.Sum(nil)))
 }
 
@@ -0,0 +1,127 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// MaxMemoLength is the longest text memo a payment can have, in bytes.
+const MaxMemoLength = 64
+
+// A Memo tells the recipient what a payment is for, like which customer or
+// invoice it belongs to. Exactly one of its fields should be set.
+// Memo is sql-json-serializable.
+type Memo struct {
+	Text string `json:"text,omitempty"`
+	ID   uint64 `json:"id,omitempty"`
+
+	// The hex-encoded sha256 of something the sender and recipient agree on
+	Hash string `json:"hash,omitempty"`
+}
+
+// ParseMemo reads a memo in the format that String writes.
+// "id:123" is an id memo, "hash:abc..." is a hash memo, and anything else is
+// a text memo. A "text:" prefix can be used for text with a colon in it.
+func ParseMemo(s string) (*Memo, error) {
+	var m *Memo
+	switch {
+	case strings.HasPrefix(s, "id:"):
+		id, err := strconv.ParseUint(strings.TrimPrefix(s, "id:"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad memo id: %s", s)
+		}
+		m = &Memo{ID: id}
+	case strings.HasPrefix(s, "hash:"):
+		m = &Memo{Hash: strings.TrimPrefix(s, "hash:")}
+	default:
+		m = &Memo{Text: strings.TrimPrefix(s, "text:")}
+	}
+	return m, m.Check()
+}
+
+func (m *Memo) String() string {
+	switch {
+	case m.ID != 0:
+		return fmt.Sprintf("id:%d", m.ID)
+	case m.Hash != "":
+		return fmt.Sprintf("hash:%s", m.Hash)
+	case strings.HasPrefix(m.Text, "id:") || strings.HasPrefix(m.Text, "hash:") ||
+		strings.HasPrefix(m.Text, "text:"):
+		return fmt.Sprintf("text:%s", m.Text)
+	default:
+		return m.Text
+	}
+}
+
+// Check returns an error if this memo is not valid to attach to a payment.
+func (m *Memo) Check() error {
+	set := 0
+	if m.Text != "" {
+		set++
+	}
+	if m.ID != 0 {
+		set++
+	}
+	if m.Hash != "" {
+		set++
+	}
+	if set != 1 {
+		return errors.New("a memo should have exactly one of text, id, or hash")
+	}
+	if len(m.Text) > MaxMemoLength {
+		return fmt.Errorf("memo text cannot be longer than %d bytes", MaxMemoLength)
+	}
+	if m.Hash != "" {
+		bytes, err := hex.DecodeString(m.Hash)
+		if err != nil || len(bytes) != 32 || m.Hash != strings.ToLower(m.Hash) {
+			return fmt.Errorf("a memo hash should be 64 lowercase hex characters: %s", m.Hash)
+		}
+	}
+	return nil
+}
+
+func (m *Memo) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	bytes := util.CanonicalJSONEncode(m)
+	return driver.Value(bytes), nil
+}
+
+func (m *Memo) Scan(src interface{}) error {
+	bytes, ok := src.([]byte)
+	if !ok {
+		return errors.New("expected []byte")
+	}
+	return json.Unmarshal(bytes, m)
+}
+
+// A PaymentRecord is a payment as it is stored in the payments index, so that
+// an account can look up what it was paid, and by whom.
+type PaymentRecord struct {
+	// The slot the payment was made in
+	Slot int `json:"slot"`
+
+	Sender    string `json:"sender"`
+	Recipient string `json:"recipient"`
+	Amount    uint64 `json:"amount"`
+
+	// nil when the payment had no memo
+	Memo *Memo `json:"memo,omitempty"`
+}
+
+func (r *PaymentRecord) String() string {
+	answer := fmt.Sprintf("payment of %d from %s to %s in slot %d",
+		r.Amount, util.Shorten(r.Sender), util.Shorten(r.Recipient), r.Slot)
+	if r.Memo != nil {
+		answer += fmt.Sprintf(" memo=%s", r.Memo)
+	}
+	return answer
+}
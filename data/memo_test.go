@@ -0,0 +1,70 @@
+package data
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/lacker/coinkit/util"
+)
+
+func TestParseMemo(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	cases := map[string]*Memo{
+		"invoice 7":      &Memo{Text: "invoice 7"},
+		"id:123":         &Memo{ID: 123},
+		"hash:" + hash:   &Memo{Hash: hash},
+		"text:id:oops":   &Memo{Text: "id:oops"},
+		"customer: blah": &Memo{Text: "customer: blah"},
+	}
+	for s, expected := range cases {
+		m, err := ParseMemo(s)
+		if err != nil {
+			t.Fatalf("could not parse %s: %s", s, err)
+		}
+		if *m != *expected {
+			t.Fatalf("parsed %s as %+v", s, m)
+		}
+		again, err := ParseMemo(m.String())
+		if err != nil || *again != *m {
+			t.Fatalf("%s did not round trip", s)
+		}
+	}
+
+	for _, s := range []string{"", "id:0", "id:x", "hash:abc", "hash:" + strings.ToUpper(hash),
+		strings.Repeat("x", MaxMemoLength+1)} {
+		if _, err := ParseMemo(s); err == nil {
+			t.Fatalf("%s should not parse", s)
+		}
+	}
+}
+
+func TestSendOperationMemo(t *testing.T) {
+	op := makeTestSendOperation(1).Operation.(*SendOperation)
+	op.Memo = &Memo{ID: 4, Text: "both"}
+	if op.Verify() == nil {
+		t.Fatalf("a memo should not have two fields set")
+	}
+	op.Memo = &Memo{ID: 4}
+	if op.Verify() != nil {
+		t.Fatalf("an id memo should verify")
+	}
+
+	kp := util.NewKeyPairFromSecretPhrase("memo sender")
+	sop := NewSignedOperation(&SendOperation{
+		Signer:   kp.PublicKey().String(),
+		Sequence: 1,
+		To:       op.To,
+		Amount:   1,
+		Memo:     &Memo{Text: "order 12"},
+	}, kp)
+	decoded := &SignedOperation{}
+	err := json.Unmarshal(util.CanonicalJSONEncode(sop), decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memo := decoded.Operation.(*SendOperation).Memo
+	if memo == nil || memo.Text != "order 12" {
+		t.Fatalf("the memo did not survive encoding: %+v", memo)
+	}
+}
@@ -0,0 +1,28 @@
+package data
+
+import (
+	"github.com/lacker/coinkit/util"
+)
+
+var queueSize = util.NewGauge(
+	"coinkit_queue_size", "Operations pending in the operation queue.")
+
+var queueRejections = util.NewCounter(
+	"coinkit_queue_rejections_total",
+	"Operations the operation queue did not accept, by reason.",
+	"reason")
+
+var dbQuerySeconds = util.NewHistogram(
+	"coinkit_db_query_seconds",
+	"Latency of handling query messages with the database, by query type.",
+	util.DefaultLatencyBuckets, "query")
+
+var dbCommitSeconds = util.NewHistogram(
+	"coinkit_db_commit_seconds",
+	"Latency of database commits.",
+	util.DefaultLatencyBuckets)
+
+var cacheLookups = util.NewCounter(
+	"coinkit_cache_lookups_total",
+	"Cache lookups by kind of object and whether they hit the cache.",
+	"kind", "result")
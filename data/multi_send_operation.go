@@ -0,0 +1,109 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// MaxPayments is the most payments a single MultiSendOperation can make.
+const MaxPayments = 1000
+
+// A Payment is one of the sends in a MultiSendOperation.
+type Payment struct {
+	To     string `json:"to"`
+	Amount uint64 `json:"amount"`
+
+	// A note for the recipient
+	Memo *Memo `json:"memo,omitempty"`
+}
+
+// MultiSendOperation sends money to many accounts at once, like a payroll.
+// It uses a single sequence number, and either every payment is made or
+// none are.
+type MultiSendOperation struct {
+	// Who is sending the money
+	Signer string `json:"signer"`
+
+	// The sequence number for this operation
+	Sequence uint32 `json:"sequence"`
+
+	// How much the signer is willing to pay to send this operation through
+	Fee uint64 `json:"fee"`
+
+	// The slots this operation can be processed in
+	Validity
+
+	Payments []*Payment `json:"payments"`
+}
+
+func (op *MultiSendOperation) String() string {
+	return fmt.Sprintf("multisend %d to %d accounts from %s, seq %d fee %d",
+		op.Total(), len(op.Payments), util.Shorten(op.Signer), op.Sequence, op.Fee)
+}
+
+func (op *MultiSendOperation) OperationType() string {
+	return "MultiSend"
+}
+
+func (op *MultiSendOperation) GetSigner() string {
+	return op.Signer
+}
+
+func (op *MultiSendOperation) GetFee() uint64 {
+	return op.Fee
+}
+
+func (op *MultiSendOperation) GetSequence() uint32 {
+	return op.Sequence
+}
+
+// Total is how much all the payments add up to. Verify makes sure this does
+// not overflow.
+func (op *MultiSendOperation) Total() uint64 {
+	total := uint64(0)
+	for _, p := range op.Payments {
+		total += p.Amount
+	}
+	return total
+}
+
+func (op *MultiSendOperation) Verify() error {
+	if len(op.Payments) == 0 {
+		return errors.New("a multisend needs at least one payment")
+	}
+	if len(op.Payments) > MaxPayments {
+		return fmt.Errorf("a multisend can make at most %d payments", MaxPayments)
+	}
+	total := uint64(0)
+	for i, p := range op.Payments {
+		if p == nil {
+			return fmt.Errorf("payment %d is nil", i)
+		}
+		if _, err := util.ReadPublicKey(p.To); err != nil {
+			return fmt.Errorf("cannot send to invalid public key: %s", p.To)
+		}
+		if p.To == op.Signer {
+			return fmt.Errorf("payment %d is to the sender", i)
+		}
+		if p.Amount == 0 {
+			return fmt.Errorf("payment %d is for nothing", i)
+		}
+		if p.Memo != nil {
+			if err := p.Memo.Check(); err != nil {
+				return fmt.Errorf("payment %d: %s", i, err)
+			}
+		}
+		if p.Amount > math.MaxUint64-total {
+			return errors.New("the payments add up to too much")
+		}
+		total += p.Amount
+	}
+	return nil
+}
+
+func init() {
+	RegisterOperationType(&MultiSendOperation{})
+}
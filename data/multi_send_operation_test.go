@@ -0,0 +1,67 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/lacker/coinkit/util"
+)
+
+func TestMultiSendOperation(t *testing.T) {
+	payer := util.NewKeyPairFromSecretPhrase("payer")
+	alice := util.NewKeyPairFromSecretPhrase("alice").PublicKey().String()
+	bob := util.NewKeyPairFromSecretPhrase("bob").PublicKey().String()
+	c := NewCache()
+	c.SetBalance(payer.PublicKey().String(), 100)
+	c.SetBalance(alice, 5)
+
+	op := &MultiSendOperation{
+		Signer:   payer.PublicKey().String(),
+		Sequence: 1,
+		Fee:      1,
+		Payments: []*Payment{
+			&Payment{To: alice, Amount: 60, Memo: &Memo{Text: "rent"}},
+			&Payment{To: bob, Amount: 40},
+		},
+	}
+	if op.Verify() != nil {
+		t.Fatalf("the multisend should verify")
+	}
+	if c.Process(op) == nil {
+		t.Fatalf("the payer cannot afford the payments and the fee")
+	}
+	if c.GetAccount(alice).Balance != 5 || c.GetAccount(bob) != nil {
+		t.Fatalf("a failed multisend should not pay anyone")
+	}
+
+	op.Payments[1].Amount = 39
+	err := c.ProcessSigned(NewSignedOperation(op, payer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.GetAccount(payer.PublicKey().String()).Balance != 0 {
+		t.Fatalf("the payer should have spent everything")
+	}
+	if c.GetAccount(alice).Balance != 65 || c.GetAccount(bob).Balance != 39 {
+		t.Fatalf("the recipients were not paid correctly")
+	}
+}
+
+func TestMultiSendOperationVerify(t *testing.T) {
+	payer := util.NewKeyPairFromSecretPhrase("payer").PublicKey().String()
+	other := util.NewKeyPairFromSecretPhrase("other").PublicKey().String()
+	op := &MultiSendOperation{Signer: payer, Sequence: 1}
+	if op.Verify() == nil {
+		t.Fatalf("a multisend with no payments should not verify")
+	}
+	op.Payments = []*Payment{&Payment{To: payer, Amount: 1}}
+	if op.Verify() == nil {
+		t.Fatalf("a multisend should not pay the sender")
+	}
+	op.Payments = []*Payment{
+		&Payment{To: other, Amount: 1 << 63},
+		&Payment{To: other, Amount: 1 << 63},
+	}
+	if op.Verify() == nil {
+		t.Fatalf("a multisend should not overflow")
+	}
+}
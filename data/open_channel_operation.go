@@ -0,0 +1,73 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// OpenChannelOperation opens a payment channel by locking up money that the
+// signer can then pay to the recipient off-chain.
+type OpenChannelOperation struct {
+	// Who is paying through the channel
+	Signer string `json:"signer"`
+
+	// The sequence number for this operation
+	Sequence uint32 `json:"sequence"`
+
+	// How much the signer is willing to pay to send this operation through
+	Fee uint64 `json:"fee"`
+
+	// The slots this operation can be processed in
+	Validity
+
+	Recipient string `json:"recipient"`
+
+	// How much money to lock up
+	Amount uint64 `json:"amount"`
+
+	// How many slots the recipient has to dispute a close by the signer
+	DisputeWindow int `json:"disputeWindow"`
+}
+
+func (op *OpenChannelOperation) String() string {
+	return fmt.Sprintf("openchannel sender=%s, recipient=%s, amount=%d",
+		util.Shorten(op.Signer), util.Shorten(op.Recipient), op.Amount)
+}
+
+func (op *OpenChannelOperation) OperationType() string {
+	return "OpenChannel"
+}
+
+func (op *OpenChannelOperation) GetSigner() string {
+	return op.Signer
+}
+
+func (op *OpenChannelOperation) GetFee() uint64 {
+	return op.Fee
+}
+
+func (op *OpenChannelOperation) GetSequence() uint32 {
+	return op.Sequence
+}
+
+func (op *OpenChannelOperation) Verify() error {
+	if _, err := util.ReadPublicKey(op.Recipient); err != nil {
+		return fmt.Errorf("invalid recipient: %s", op.Recipient)
+	}
+	if op.Recipient == op.Signer {
+		return errors.New("cannot open a channel to yourself")
+	}
+	if op.Amount == 0 {
+		return errors.New("cannot open an empty channel")
+	}
+	if op.DisputeWindow <= 0 || op.DisputeWindow > MaxDisputeWindow {
+		return fmt.Errorf("the dispute window must be between 1 and %d slots", MaxDisputeWindow)
+	}
+	return nil
+}
+
+func init() {
+	RegisterOperationType(&OpenChannelOperation{})
+}
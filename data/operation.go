@@ -1,6 +1,7 @@
 package data
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"strings"
@@ -33,6 +34,10 @@ type Operation interface {
 	// GetSequence() returns the number in sequence that this operation is for the signer
 	// This prevents most replay attacks
 	GetSequence() uint32
+
+	// GetValidity() returns the slots in which this operation can be processed.
+	// Operations get it by embedding a Validity.
+	GetValidity() Validity
 }
 
 // OperationTypeMap maps into struct types whose pointer-types implement Operation.
@@ -57,6 +62,31 @@ func RegisterOperationType(op Operation) {
 	OperationTypeMap[name] = sv.Type()
 }
 
+// decodeOperation decodes and verifies an operation of a registered type.
+func decodeOperation(opType string, encoded json.RawMessage) (Operation, error) {
+	t, ok := OperationTypeMap[opType]
+	if !ok {
+		return nil, fmt.Errorf("unregistered op type: %s", opType)
+	}
+	op := reflect.New(t).Interface().(Operation)
+	err := json.Unmarshal(encoded, &op)
+	if err != nil {
+		return nil, err
+	}
+	if op == nil {
+		return nil, fmt.Errorf("decoding a nil operation is not valid")
+	}
+	err = op.Verify()
+	if err != nil {
+		return nil, err
+	}
+	err = op.GetValidity().Check()
+	if err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
 func StringifyOperations(ops []*SignedOperation) string {
 	parts := []string{}
 	limit := 2
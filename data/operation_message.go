@@ -1,6 +1,7 @@
 package data
 
 import (
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
@@ -63,6 +64,26 @@ func NewOperationMessageWithChunk(chunk *LedgerChunk) *OperationMessage {
 	}
 }
 
+// CheckLimits only decodes the message shallowly, so that we can reject
+// oversized messages before verifying the signature on every operation.
+func (m *OperationMessage) CheckLimits(encoded []byte, limits *util.MessageLimits) error {
+	var shallow struct {
+		Operations []json.RawMessage          `json:"operations"`
+		Chunks     map[string]json.RawMessage `json:"chunks"`
+	}
+	err := json.Unmarshal(encoded, &shallow)
+	if err != nil {
+		return err
+	}
+	if limits.MaxOperations > 0 && len(shallow.Operations) > limits.MaxOperations {
+		return &util.LimitError{Kind: "operations", Limit: limits.MaxOperations}
+	}
+	if limits.MaxChunks > 0 && len(shallow.Chunks) > limits.MaxChunks {
+		return &util.LimitError{Kind: "chunks", Limit: limits.MaxChunks}
+	}
+	return nil
+}
+
 func init() {
 	util.RegisterMessageType(&OperationMessage{})
 }
@@ -65,3 +65,29 @@ func TestUpdateBucketOperationMessageFromJS(t *testing.T) {
 		t.Fatalf("could not decode signed message: %s", err)
 	}
 }
+
+func TestOperationMessageLimits(t *testing.T) {
+	kp := util.NewKeyPairFromSecretPhrase("key pair 1")
+	ops := []*SignedOperation{}
+	for i := 1; i <= 3; i++ {
+		ops = append(ops, NewSignedOperation(&SendOperation{
+			Sequence: uint32(i),
+			Amount:   1,
+			Fee:      1,
+			Signer:   kp.PublicKey().String(),
+			To:       kp.PublicKey().String(),
+		}, kp))
+	}
+	encoded := util.EncodeMessage(NewOperationMessage(ops...))
+	limits := &util.MessageLimits{MaxOperations: 2}
+	_, err := util.DecodeLimitedMessage(encoded, limits)
+	le, ok := err.(*util.LimitError)
+	if !ok || le.Kind != "operations" {
+		t.Fatalf("expected an operations limit error but got %v", err)
+	}
+	limits.MaxOperations = 3
+	_, err = util.DecodeLimitedMessage(encoded, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,6 +2,7 @@ package data
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/emirpasic/gods/sets/treeset"
 
@@ -12,6 +13,14 @@ import (
 // QueueLimit defines how many items will be held in the queue at a time
 const QueueLimit = 1000
 
+// SignerQueueLimit defines how many items a single signer can have in the
+// queue at a time, so that one signer cannot fill up the whole queue.
+const SignerQueueLimit = 25
+
+// MaxOperationAge is how many slots an operation can wait in the queue
+// before it expires.
+const MaxOperationAge = 50
+
 // OperationQueue keeps the operations that are pending but have neither
 // been rejected nor confirmed.
 // OperationQueue is not threadsafe.
@@ -22,6 +31,14 @@ type OperationQueue struct {
 	// The pool of pending operations.
 	set *treeset.Set
 
+	// The pending operations for each signer, in no particular order.
+	// This contains the same operations as set.
+	bySigner map[string][]*SignedOperation
+
+	// The slot we were working on when each pending operation was added,
+	// keyed by signature
+	addedSlot map[string]int
+
 	// The ledger chunks that are being considered
 	// They are indexed by their hash
 	chunks map[consensus.SlotValue]*LedgerChunk
@@ -43,6 +60,10 @@ type OperationQueue struct {
 
 	// A count of the number of operations this queue has finalized
 	finalized int
+
+	// Statuses tracks what happened to the operations we have seen.
+	// It is threadsafe, so it can be read while the queue is in use.
+	Statuses *StatusTracker
 }
 
 func NewOperationQueue(publicKey util.PublicKey, db *Database,
@@ -50,11 +71,14 @@ func NewOperationQueue(publicKey util.PublicKey, db *Database,
 	q := &OperationQueue{
 		publicKey: publicKey,
 		set:       treeset.NewWith(HighestFeeFirst),
+		bySigner:  make(map[string][]*SignedOperation),
+		addedSlot: make(map[string]int),
 		chunks:    make(map[consensus.SlotValue]*LedgerChunk),
 		lastHash:  lastChunk.Hash(),
 		lastChunk: lastChunk,
 		slot:      slot,
 		finalized: 0,
+		Statuses:  NewStatusTracker(MaxTrackedStatuses),
 	}
 
 	if lastChunk == nil && slot != 1 {
@@ -79,6 +103,16 @@ func NewOperationQueue(publicKey util.PublicKey, db *Database,
 
 		q.cache = NewDatabaseCache(db, nextDocumentID, nextProviderID)
 	}
+	if lastChunk != nil {
+		q.cache.BaseFee = lastChunk.BaseFee
+		if lastChunk.NextClaimID != 0 {
+			q.cache.NextClaimID = lastChunk.NextClaimID
+		}
+		if lastChunk.NextChannelID != 0 {
+			q.cache.NextChannelID = lastChunk.NextChannelID
+		}
+	}
+	q.cache.Slot = slot
 	return q
 }
 
@@ -103,10 +137,24 @@ func (q *OperationQueue) Top(n int) []*SignedOperation {
 
 // Remove removes an operation from the queue
 func (q *OperationQueue) Remove(op *SignedOperation) {
-	if op == nil {
+	if op == nil || !q.set.Contains(op) {
 		return
 	}
 	q.set.Remove(op)
+	signer := op.GetSigner()
+	remaining := []*SignedOperation{}
+	for _, other := range q.bySigner[signer] {
+		if other.Signature != op.Signature {
+			remaining = append(remaining, other)
+		}
+	}
+	if len(remaining) == 0 {
+		delete(q.bySigner, signer)
+	} else {
+		q.bySigner[signer] = remaining
+	}
+	delete(q.addedSlot, op.Signature)
+	queueSize.Set(float64(q.set.Size()))
 }
 
 func (q *OperationQueue) Logf(format string, a ...interface{}) {
@@ -115,29 +163,48 @@ func (q *OperationQueue) Logf(format string, a ...interface{}) {
 
 // Add adds an operation to the queue
 // If it isn't valid, we just discard it.
+// If it has the same signer and sequence as a pending operation, but a
+// higher fee, it replaces that operation.
 // We don't constantly revalidate so it's possible we have invalid
 // operations in the queue, if a higher-fee operation that conflicts with a particular
 // operation is added after it is.
 // Returns whether any changes were made.
 func (q *OperationQueue) Add(op *SignedOperation) bool {
-	if !q.Validate(op) {
+	err := q.Check(op)
+	if err != nil {
+		if op != nil {
+			q.Statuses.Invalidated(op.Signature, err)
+		}
 		return false
 	}
 	if q.Contains(op) {
 		return false
 	}
 
+	// Check made sure that any operation this conflicts with has a lower fee
+	for _, old := range q.bySigner[op.GetSigner()] {
+		if old.GetSequence() == op.GetSequence() {
+			q.Remove(old)
+			q.Statuses.Replaced(old.Signature)
+		}
+	}
+
 	// q.Logf("saw a new operation: %s", op.Operation)
 	q.set.Add(op)
+	q.bySigner[op.GetSigner()] = append(q.bySigner[op.GetSigner()], op)
+	q.addedSlot[op.Signature] = q.slot
+	q.Statuses.Queued(op.Signature)
 
 	if q.set.Size() > QueueLimit {
 		it := q.set.Iterator()
 		if !it.Last() {
 			util.Logger.Fatal("logical failure with treeset")
 		}
-		worst := it.Value()
-		q.set.Remove(worst)
+		worst := it.Value().(*SignedOperation)
+		q.Remove(worst)
+		q.Statuses.Evicted(worst.Signature)
 	}
+	queueSize.Set(float64(q.set.Size()))
 
 	return q.Contains(op)
 }
@@ -203,12 +270,36 @@ func (q *OperationQueue) HandleOperationMessage(m *OperationMessage) (*util.Erro
 	var em *util.ErrorMessage
 	updated := false
 	if m.Operations != nil {
+		var firstErr error
 		for _, op := range m.Operations {
-			updated = updated || q.Add(op)
+			err := q.Check(op)
+			if err != nil {
+				queueRejections.Inc("invalid")
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			if q.Contains(op) {
+				queueRejections.Inc("pending")
+				if firstErr == nil {
+					firstErr = fmt.Errorf("operation is already pending")
+				}
+				continue
+			}
+			if q.Add(op) {
+				updated = true
+			} else {
+				queueRejections.Inc("evicted")
+			}
 		}
 		if !updated {
+			message := "no valid operations in operation message"
+			if firstErr != nil {
+				message = fmt.Sprintf("%s: %s", message, firstErr)
+			}
 			em = &util.ErrorMessage{
-				Error: "no valid operations in operation message",
+				Error: message,
 			}
 		}
 	}
@@ -239,26 +330,175 @@ func (q *OperationQueue) Size() int {
 }
 
 func (q *OperationQueue) Validate(op *SignedOperation) bool {
+	return q.Check(op) == nil
+}
+
+// Check returns an error describing why the operation is not valid to add
+// to the queue, or nil if it is valid.
+func (q *OperationQueue) Check(op *SignedOperation) error {
 	if op == nil {
-		return false
+		return fmt.Errorf("nil operation")
 	}
 	if op.Operation == nil {
-		return false
+		return fmt.Errorf("signed operation has no operation")
 	}
-	if op.Operation.Verify() != nil {
-		return false
+	err := op.Operation.Verify()
+	if err != nil {
+		return err
 	}
-	if q.cache.Validate(op.Operation) != nil {
-		return false
+
+	// Limit what a single signer can have pending
+	signer := op.GetSigner()
+	count := 0
+	for _, other := range q.bySigner[signer] {
+		if other.Signature == op.Signature {
+			continue
+		}
+		if other.GetSequence() != op.GetSequence() {
+			count++
+			continue
+		}
+		if other.Operation.GetFee() >= op.Operation.GetFee() {
+			return fmt.Errorf("an operation with sequence %d and fee %d is already pending "+
+				"for user %s, so a replacement needs a higher fee",
+				other.GetSequence(), other.Operation.GetFee(), signer)
+		}
+	}
+	if count >= SignerQueueLimit {
+		return fmt.Errorf("user %s already has %d pending operations", signer, count)
 	}
-	return true
+
+	validator, err := q.pipeline(signer, op.GetSequence())
+	if err != nil {
+		return err
+	}
+	return validator.ValidateSigned(op)
 }
 
-// Revalidate checks all pending operations to see if they are still valid
-func (q *OperationQueue) Revalidate() {
+// pipeline returns a cache with the signer's pending operations that come
+// before the provided sequence number processed, in order, on top of the
+// current state. This lets a signer queue up a contiguous run of
+// operations without waiting for each one to be finalized.
+// It returns an error if there is a gap in the run.
+func (q *OperationQueue) pipeline(signer string, sequence uint32) (*Cache, error) {
+	account := q.cache.GetAccount(signer)
+	if account == nil || sequence <= account.Sequence+1 {
+		return q.cache, nil
+	}
+
+	// When several pending operations have the same sequence number, we try
+	// the highest fee first, like NewChunk does.
+	pending := make(map[uint32][]*SignedOperation)
+	for _, op := range q.bySigner[signer] {
+		pending[op.GetSequence()] = append(pending[op.GetSequence()], op)
+	}
+	// A transaction can use up several of the signer's sequence numbers, so
+	// the next one to look for comes from the account, not a counter.
+	layer := q.cache.CowCopy()
+	for s := account.Sequence + 1; s < sequence; s = layer.GetAccount(signer).Sequence + 1 {
+		candidates := pending[s]
+		sort.Slice(candidates, func(i, j int) bool {
+			return HighestFeeFirst(candidates[i], candidates[j]) < 0
+		})
+		processed := false
+		for _, op := range candidates {
+			if layer.ProcessSigned(op) == nil {
+				processed = true
+				break
+			}
+		}
+		if !processed {
+			return nil, fmt.Errorf("%d is not the right sequence id for user %s, "+
+				"because no valid operation with sequence %d is pending", sequence, signer, s)
+		}
+	}
+	return layer, nil
+}
+
+// QueueStats returns statistics about the operations in the queue.
+func (q *OperationQueue) QueueStats() *QueueStats {
+	ops := q.Operations()
+	stats := &QueueStats{
+		Size:         len(ops),
+		Limit:        QueueLimit,
+		BaseFee:      q.cache.BaseFee,
+		AdmissionFee: q.cache.BaseFee,
+	}
+	if len(ops) == 0 {
+		return stats
+	}
+
+	// The operations are sorted highest fee first
+	stats.MaxFee = ops[0].Operation.GetFee()
+	stats.MedianFee = ops[len(ops)/2].Operation.GetFee()
+	stats.MinFee = ops[len(ops)-1].Operation.GetFee()
+	if len(ops) >= QueueLimit && stats.MinFee+1 > stats.AdmissionFee {
+		stats.AdmissionFee = stats.MinFee + 1
+	}
+	return stats
+}
+
+// PendingDataMessage responds to a query for pending operations.
+func (q *OperationQueue) PendingDataMessage(query *PendingQuery) *DataMessage {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultPendingLimit
+	}
+	pending := []*SignedOperation{}
 	for _, op := range q.Operations() {
-		if !q.Validate(op) {
+		if len(pending) >= limit {
+			break
+		}
+		if query.Matches(op) {
+			pending = append(pending, op)
+		}
+	}
+	return &DataMessage{
+		I:          q.slot - 1,
+		Pending:    pending,
+		QueueStats: q.QueueStats(),
+	}
+}
+
+// Simulate describes what the operations in a SimulateMessage would do if
+// they were processed in order, without changing any real data.
+func (q *OperationQueue) Simulate(m *SimulateMessage) *SimulationMessage {
+	answer := &SimulationMessage{
+		I:       q.slot - 1,
+		Results: []*SimulationResult{},
+	}
+	base := q.cache.CowCopy()
+	for _, op := range m.Operations {
+		result := base.Simulate(op)
+		if result.Error == "" {
+			// Later operations should see the effects of this one
+			base.ProcessSigned(op)
+		}
+		answer.Results = append(answer.Results, result)
+	}
+	return answer
+}
+
+// Revalidate checks all pending operations to see if they are still valid,
+// and expires the ones that have been waiting too long.
+func (q *OperationQueue) Revalidate() {
+	// Earlier sequence numbers go first, so that when an operation is
+	// removed, the operations that depended on it are removed too.
+	ops := q.Operations()
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].GetSequence() < ops[j].GetSequence()
+	})
+	for _, op := range ops {
+		if q.slot-q.addedSlot[op.Signature] > MaxOperationAge ||
+			op.GetValidity().Expired(q.slot) {
 			q.Remove(op)
+			q.Statuses.Expired(op.Signature)
+			continue
+		}
+		err := q.Check(op)
+		if err != nil {
+			q.Remove(op)
+			q.Statuses.Invalidated(op.Signature, err)
 		}
 	}
 }
@@ -268,39 +508,84 @@ func (q *OperationQueue) Revalidate() {
 // should be verified.
 // Returns "", nil if there were no valid operations.
 // This adds a chunk to q.chunks
+// Operations whose sequence number is ahead of their signer's are included
+// once the operations before them are, so the chunk is not necessarily
+// sorted.
 func (q *OperationQueue) NewChunk(
 	ops []*SignedOperation) (consensus.SlotValue, *LedgerChunk) {
 
 	var last *SignedOperation
 	validOps := []*SignedOperation{}
 	validator := q.cache.CowCopy()
-	state := make(map[string]*Account)
-	for _, op := range ops {
-		if last != nil && HighestFeeFirst(last, op) >= 0 {
-			panic("NewLedgerChunk called on non-sorted list")
+
+	// Operations that are waiting on an earlier sequence number, by signer
+	deferred := make(map[string][]*SignedOperation)
+
+	var process func(op *SignedOperation)
+	process = func(op *SignedOperation) {
+		if len(validOps) == MaxChunkSize {
+			return
 		}
-		last = op
-		if validator.Process(op.Operation) == nil {
-			validOps = append(validOps, op)
+		signer := op.GetSigner()
+		if validator.ProcessSigned(op) != nil {
+			account := validator.GetAccount(signer)
+			if account != nil && op.GetSequence() > account.Sequence+1 {
+				deferred[signer] = append(deferred[signer], op)
+			}
+			return
 		}
-		state[op.GetSigner()] = validator.GetAccount(op.GetSigner())
+		validOps = append(validOps, op)
 
-		if t, ok := op.Operation.(*SendOperation); ok {
-			state[t.To] = validator.GetAccount(t.To)
+		// The next operation for this signer may have been waiting on this one
+		waiting := deferred[signer]
+		delete(deferred, signer)
+		for _, w := range waiting {
+			process(w)
 		}
+	}
 
+	for _, op := range ops {
+		if last != nil && HighestFeeFirst(last, op) >= 0 {
+			panic("NewLedgerChunk called on non-sorted list")
+		}
+		last = op
+		process(op)
 		if len(validOps) == MaxChunkSize {
 			break
 		}
 	}
-	if len(ops) == 0 {
+	if len(validOps) == 0 {
 		return consensus.SlotValue(""), nil
 	}
+	// The validator only holds the accounts that the operations changed
+	state := make(map[string]*Account)
+	for owner, account := range validator.accounts {
+		state[owner] = account
+	}
+	var assets map[string]*Asset
+	if len(validator.assets) > 0 {
+		assets = make(map[string]*Asset)
+		for key, asset := range validator.assets {
+			assets[key] = asset
+		}
+	}
+	var trustlines map[string]*Trustline
+	if len(validator.trustlines) > 0 {
+		trustlines = make(map[string]*Trustline)
+		for key, trustline := range validator.trustlines {
+			trustlines[key] = trustline
+		}
+	}
 	chunk := &LedgerChunk{
-		Operations:     ops,
+		Operations:     validOps,
 		Accounts:       state,
+		Assets:         assets,
+		Trustlines:     trustlines,
 		NextDocumentID: validator.NextDocumentID,
 		NextProviderID: validator.NextProviderID,
+		NextClaimID:    validator.NextClaimID,
+		NextChannelID:  validator.NextChannelID,
+		BaseFee:        ChunkBaseFee(validator.Slot, validator.BaseFee, len(validOps)),
 	}
 	key := chunk.Hash()
 	if _, ok := q.chunks[key]; !ok {
@@ -354,6 +639,10 @@ func (q *OperationQueue) Finalize(
 		D:     qs,
 	}
 	q.cache.FinalizeBlock(block)
+	for _, op := range chunk.Operations {
+		q.Remove(op)
+		q.Statuses.Finalized(op.Signature, q.slot)
+	}
 
 	q.finalized += len(chunk.Operations)
 	q.lastHash = v
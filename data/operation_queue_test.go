@@ -2,6 +2,8 @@ package data
 
 import (
 	"testing"
+
+	"github.com/lacker/coinkit/util"
 )
 
 func TestFullQueue(t *testing.T) {
@@ -23,6 +25,12 @@ func TestFullQueue(t *testing.T) {
 	if top[10].Operation.(*SendOperation).Amount != QueueLimit {
 		t.Fatalf("top is wrong")
 	}
+	if q.Statuses.Get(makeTestSendOperation(1).Signature).State != StatusEvicted {
+		t.Fatalf("the lowest fee operation should have been evicted")
+	}
+	if q.Statuses.Get(top[0].Signature).State != StatusQueued {
+		t.Fatalf("the highest fee operation should be queued")
+	}
 	for i := 1; i <= QueueLimit+10; i++ {
 		q.Remove(makeTestSendOperation(i))
 	}
@@ -66,3 +74,170 @@ func TestCreateDocumentOperation(t *testing.T) {
 		t.Fatal("there should be an op message with a create operation")
 	}
 }
+
+func TestPendingDataMessage(t *testing.T) {
+	q := NewTestingOperationQueue()
+	for i := 1; i <= 3; i++ {
+		op := makeTestSendOperation(i)
+		q.cache.SetBalance(op.GetSigner(), 100)
+		q.Add(op)
+	}
+
+	dm := q.PendingDataMessage(&PendingQuery{MinFee: 2})
+	if len(dm.Pending) != 2 || dm.Pending[0].Operation.GetFee() != 3 {
+		t.Fatalf("expected the two highest fee operations but got %+v", dm.Pending)
+	}
+	stats := dm.QueueStats
+	if stats.Size != 3 || stats.MinFee != 1 || stats.MedianFee != 2 || stats.MaxFee != 3 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats.AdmissionFee != 0 {
+		t.Fatalf("any fee should be admitted when the queue is not full")
+	}
+
+	signer := makeTestSendOperation(1).GetSigner()
+	dm = q.PendingDataMessage(&PendingQuery{Signer: signer, Type: "Send"})
+	if len(dm.Pending) != 1 || dm.Pending[0].GetSigner() != signer {
+		t.Fatalf("expected one operation for the signer but got %+v", dm.Pending)
+	}
+	dm = q.PendingDataMessage(&PendingQuery{Type: "CreateDocument"})
+	if len(dm.Pending) != 0 {
+		t.Fatalf("expected no document operations")
+	}
+	dm = q.PendingDataMessage(&PendingQuery{Limit: 1})
+	if len(dm.Pending) != 1 {
+		t.Fatalf("the limit was not respected")
+	}
+}
+
+func TestPipelinedSequences(t *testing.T) {
+	q := NewTestingOperationQueue()
+	kp := util.NewKeyPairFromSecretPhrase("pipeliner")
+	signer := kp.PublicKey().String()
+	q.cache.SetBalance(signer, 100)
+	send := func(sequence uint32, fee uint64) *SignedOperation {
+		return NewSignedOperation(&SendOperation{
+			Signer:   signer,
+			Sequence: sequence,
+			To:       util.NewKeyPairFromSecretPhrase("destination").PublicKey().String(),
+			Amount:   10,
+			Fee:      fee,
+		}, kp)
+	}
+
+	if q.Add(send(2, 1)) {
+		t.Fatalf("an operation after a gap should not be added")
+	}
+	first := send(1, 1)
+	for _, op := range []*SignedOperation{first, send(2, 3), send(3, 2)} {
+		if !q.Add(op) {
+			t.Fatalf("could not add %s", op.Operation)
+		}
+	}
+
+	// The chunk has to put the operations in sequence order, even though
+	// the later ones have higher fees
+	_, chunk := q.NewChunk(q.Operations())
+	if chunk == nil || len(chunk.Operations) != 3 {
+		t.Fatalf("expected all three operations in the chunk")
+	}
+	for i, op := range chunk.Operations {
+		if op.GetSequence() != uint32(i+1) {
+			t.Fatalf("the chunk is out of order: %s", chunk)
+		}
+	}
+	if chunk.Accounts[signer].Balance != 100-3*10-6 {
+		t.Fatalf("unexpected account in the chunk: %+v", chunk.Accounts[signer])
+	}
+
+	// Without the first operation, the rest are not valid
+	q.Remove(first)
+	q.Revalidate()
+	if q.Size() != 0 {
+		t.Fatalf("expected the queue to be empty but it has %d", q.Size())
+	}
+
+	// A transaction uses up a sequence number for each of the signer's
+	// operations inside it
+	tx := NewSignedOperation(&TransactionOperation{
+		Signer:   signer,
+		Sequence: 1,
+		Fee:      1,
+		Operations: []*InnerOperation{NewInnerOperation(&SendOperation{
+			Signer:   signer,
+			Sequence: 2,
+			To:       util.NewKeyPairFromSecretPhrase("destination").PublicKey().String(),
+			Amount:   10,
+		})},
+	}, kp)
+	if !q.Add(tx) {
+		t.Fatalf("could not add the transaction")
+	}
+	if q.Add(send(2, 5)) {
+		t.Fatalf("the transaction already used sequence 2")
+	}
+	if !q.Add(send(3, 1)) {
+		t.Fatalf("could not add the operation after the transaction")
+	}
+	_, chunk = q.NewChunk(q.Operations())
+	if chunk == nil || len(chunk.Operations) != 2 {
+		t.Fatalf("expected the transaction and the send in the chunk")
+	}
+	if chunk.Accounts[signer].Sequence != 3 || chunk.Accounts[signer].Balance != 100-2*10-2 {
+		t.Fatalf("unexpected account in the chunk: %+v", chunk.Accounts[signer])
+	}
+}
+
+func TestReplaceByFee(t *testing.T) {
+	q := NewTestingOperationQueue()
+	kp := util.NewKeyPairFromSecretPhrase("replacer")
+	signer := kp.PublicKey().String()
+	q.cache.SetBalance(signer, 1000)
+	send := func(sequence uint32, fee uint64) *SignedOperation {
+		return NewSignedOperation(&SendOperation{
+			Signer:   signer,
+			Sequence: sequence,
+			To:       util.NewKeyPairFromSecretPhrase("destination").PublicKey().String(),
+			Amount:   1,
+			Fee:      fee,
+		}, kp)
+	}
+
+	original := send(1, 2)
+	if !q.Add(original) {
+		t.Fatalf("could not add the original")
+	}
+	if q.Add(send(1, 2)) {
+		t.Fatalf("a replacement with the same fee should be rejected")
+	}
+	bumped := send(1, 3)
+	if !q.Add(bumped) {
+		t.Fatalf("a replacement with a higher fee should be accepted")
+	}
+	if q.Size() != 1 || q.Contains(original) || !q.Contains(bumped) {
+		t.Fatalf("the original should have been replaced")
+	}
+	if q.Statuses.Get(original.Signature).State != StatusReplaced {
+		t.Fatalf("the original should be marked as replaced")
+	}
+
+	// One signer cannot take over the queue
+	for i := 2; i <= SignerQueueLimit; i++ {
+		if !q.Add(send(uint32(i), 1)) {
+			t.Fatalf("could not add sequence %d", i)
+		}
+	}
+	if q.Add(send(SignerQueueLimit+1, 1)) {
+		t.Fatalf("the signer should be over the limit")
+	}
+
+	// Everything expires eventually
+	q.slot += MaxOperationAge + 1
+	q.Revalidate()
+	if q.Size() != 0 {
+		t.Fatalf("expected everything to expire but %d operations are left", q.Size())
+	}
+	if q.Statuses.Get(bumped.Signature).State != StatusExpired {
+		t.Fatalf("expected the operation to be marked as expired")
+	}
+}
@@ -0,0 +1,155 @@
+package data
+
+import (
+	"sync"
+)
+
+// The states an operation can be in, as far as a single node knows.
+const (
+	// The node has never heard of the operation, or has forgotten about it.
+	StatusUnknown = "unknown"
+
+	// The operation arrived, but the node has not looked at it yet.
+	StatusReceived = "received"
+
+	// The operation is in the queue, waiting to be included in a block.
+	StatusQueued = "queued"
+
+	// The operation was dropped because the queue was full of operations
+	// with higher fees.
+	StatusEvicted = "evicted"
+
+	// The operation was replaced by one with the same sequence number and a
+	// higher fee.
+	StatusReplaced = "replaced"
+
+	// The operation waited in the queue for too long.
+	StatusExpired = "expired"
+
+	// The operation was not valid, either when it arrived or after other
+	// operations were finalized.
+	StatusInvalidated = "invalidated"
+
+	// The operation was included in a finalized block.
+	StatusFinalized = "finalized"
+)
+
+// MaxTrackedStatuses is how many operations a node remembers the status of.
+// When there are more, the ones it heard about first are forgotten.
+const MaxTrackedStatuses = 10000
+
+// OperationStatus describes where an operation is.
+type OperationStatus struct {
+	Signature string `json:"signature"`
+	State     string `json:"state"`
+
+	// For invalidated operations, why they are not valid
+	Error string `json:"error,omitempty"`
+
+	// For finalized operations, the slot of the block they are in
+	Slot int `json:"slot,omitempty"`
+}
+
+// IsRejected returns whether the operation left the queue without being
+// finalized. It will not be finalized unless it is submitted again.
+func (s *OperationStatus) IsRejected() bool {
+	switch s.State {
+	case StatusEvicted, StatusReplaced, StatusExpired, StatusInvalidated:
+		return true
+	}
+	return false
+}
+
+// A StatusTracker remembers the status of a bounded number of operations.
+// StatusTracker is threadsafe.
+type StatusTracker struct {
+	mutex    sync.Mutex
+	limit    int
+	statuses map[string]*OperationStatus
+
+	// The signatures in the order we started tracking them
+	order []string
+}
+
+func NewStatusTracker(limit int) *StatusTracker {
+	return &StatusTracker{
+		limit:    limit,
+		statuses: make(map[string]*OperationStatus),
+		order:    []string{},
+	}
+}
+
+// Get never returns nil. Operations we know nothing about are unknown.
+func (t *StatusTracker) Get(signature string) *OperationStatus {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	status, ok := t.statuses[signature]
+	if !ok {
+		return &OperationStatus{Signature: signature, State: StatusUnknown}
+	}
+	answer := *status
+	return &answer
+}
+
+// set records a new status for an operation.
+// Finalization is permanent, so a finalized operation is never changed.
+func (t *StatusTracker) set(status *OperationStatus) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	old, ok := t.statuses[status.Signature]
+	if ok && old.State == StatusFinalized {
+		return
+	}
+	t.insert(status)
+}
+
+// insert must be called while holding the mutex.
+func (t *StatusTracker) insert(status *OperationStatus) {
+	if status.Signature == "" {
+		return
+	}
+	_, ok := t.statuses[status.Signature]
+	t.statuses[status.Signature] = status
+	if ok {
+		return
+	}
+	t.order = append(t.order, status.Signature)
+	for len(t.order) > t.limit {
+		delete(t.statuses, t.order[0])
+		t.order = t.order[1:]
+	}
+}
+
+// Received only changes the status of operations we know nothing about, so
+// that receiving an operation again does not hide what happened to it.
+func (t *StatusTracker) Received(signature string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if _, ok := t.statuses[signature]; !ok {
+		t.insert(&OperationStatus{Signature: signature, State: StatusReceived})
+	}
+}
+
+func (t *StatusTracker) Queued(signature string) {
+	t.set(&OperationStatus{Signature: signature, State: StatusQueued})
+}
+
+func (t *StatusTracker) Evicted(signature string) {
+	t.set(&OperationStatus{Signature: signature, State: StatusEvicted})
+}
+
+func (t *StatusTracker) Replaced(signature string) {
+	t.set(&OperationStatus{Signature: signature, State: StatusReplaced})
+}
+
+func (t *StatusTracker) Expired(signature string) {
+	t.set(&OperationStatus{Signature: signature, State: StatusExpired})
+}
+
+func (t *StatusTracker) Invalidated(signature string, err error) {
+	t.set(&OperationStatus{Signature: signature, State: StatusInvalidated, Error: err.Error()})
+}
+
+func (t *StatusTracker) Finalized(signature string, slot int) {
+	t.set(&OperationStatus{Signature: signature, State: StatusFinalized, Slot: slot})
+}
@@ -0,0 +1,42 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStatusTracker(t *testing.T) {
+	tracker := NewStatusTracker(2)
+	if tracker.Get("a").State != StatusUnknown {
+		t.Fatalf("untracked operations should be unknown")
+	}
+
+	tracker.Received("a")
+	tracker.Queued("a")
+	tracker.Received("a")
+	if tracker.Get("a").State != StatusQueued {
+		t.Fatalf("receiving again should not change the status")
+	}
+
+	tracker.Invalidated("a", errors.New("bad sequence"))
+	status := tracker.Get("a")
+	if status.State != StatusInvalidated || status.Error != "bad sequence" {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	tracker.Finalized("b", 7)
+	tracker.Evicted("b")
+	status = tracker.Get("b")
+	if status.State != StatusFinalized || status.Slot != 7 {
+		t.Fatalf("finalization should be permanent, but got %+v", status)
+	}
+
+	// The oldest status is forgotten once there are too many
+	tracker.Queued("c")
+	if tracker.Get("a").State != StatusUnknown {
+		t.Fatalf("a should have been forgotten")
+	}
+	if tracker.Get("b").State != StatusFinalized || tracker.Get("c").State != StatusQueued {
+		t.Fatalf("b and c should be remembered")
+	}
+}
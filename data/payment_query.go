@@ -0,0 +1,36 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// A PaymentQuery looks up the payments an account has received, most recent
+// first.
+type PaymentQuery struct {
+	Recipient string `json:"recipient"`
+
+	// When Memo is non-nil, only payments with this exact memo match
+	Memo *Memo `json:"memo,omitempty"`
+
+	Limit int `json:"limit"`
+}
+
+func (q *PaymentQuery) String() string {
+	parts := []string{}
+	if q.Recipient != "" {
+		parts = append(parts, fmt.Sprintf("recipient=%s", util.Shorten(q.Recipient)))
+	}
+	if q.Memo != nil {
+		parts = append(parts, fmt.Sprintf("memo=%s", q.Memo))
+	}
+	if q.Limit != 0 {
+		parts = append(parts, fmt.Sprintf("limit=%d", q.Limit))
+	}
+	if len(parts) == 0 {
+		return "<empty>"
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,79 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// DefaultPendingLimit is how many pending operations a PendingQuery returns
+// when it does not specify a limit.
+const DefaultPendingLimit = 100
+
+// A PendingQuery asks for operations that are waiting in the queue, and for
+// statistics about the queue.
+// The operations are returned highest fee first.
+type PendingQuery struct {
+	// When Signer is nonempty, only operations with this signer are returned.
+	Signer string `json:"signer"`
+
+	// When Type is nonempty, only operations of this type are returned.
+	// It is an OperationType, like "Send".
+	Type string `json:"type"`
+
+	// Only operations with at least this fee are returned.
+	MinFee uint64 `json:"minFee"`
+
+	Limit int `json:"limit"`
+}
+
+func (q *PendingQuery) String() string {
+	parts := []string{}
+	if q.Signer != "" {
+		parts = append(parts, fmt.Sprintf("signer=%s", util.Shorten(q.Signer)))
+	}
+	if q.Type != "" {
+		parts = append(parts, fmt.Sprintf("type=%s", q.Type))
+	}
+	if q.MinFee != 0 {
+		parts = append(parts, fmt.Sprintf("minFee=%d", q.MinFee))
+	}
+	if q.Limit != 0 {
+		parts = append(parts, fmt.Sprintf("limit=%d", q.Limit))
+	}
+	if len(parts) == 0 {
+		return "<empty>"
+	}
+	return strings.Join(parts, " ")
+}
+
+func (q *PendingQuery) Matches(op *SignedOperation) bool {
+	if q.Signer != "" && op.GetSigner() != q.Signer {
+		return false
+	}
+	if q.Type != "" && op.Operation.OperationType() != q.Type {
+		return false
+	}
+	return op.Operation.GetFee() >= q.MinFee
+}
+
+// QueueStats describes the operation queue as a whole.
+type QueueStats struct {
+	Size  int `json:"size"`
+	Limit int `json:"limit"`
+
+	// The lowest fee that any operation can have right now
+	BaseFee uint64 `json:"baseFee"`
+
+	// The distribution of fees in the queue. They are all zero when the
+	// queue is empty.
+	MinFee    uint64 `json:"minFee"`
+	MedianFee uint64 `json:"medianFee"`
+	MaxFee    uint64 `json:"maxFee"`
+
+	// AdmissionFee is the lowest fee that is sure to get a new operation into
+	// the queue. It is at least the base fee, and when the queue is full, an
+	// operation also has to beat the lowest fee in it.
+	AdmissionFee uint64 `json:"admissionFee"`
+}
@@ -28,9 +28,24 @@ type QueryMessage struct {
 	// When Providers is non-nil, this message is requesting data for matching providers.
 	Providers *ProviderQuery `json:"providers"`
 
+	// When Payments is non-nil, this message is requesting the payments an
+	// account has received.
+	Payments *PaymentQuery `json:"payments,omitempty"`
+
 	// When Signature is nonempty, this message is requesting a committed
 	// SignedOperation with this signature.
 	Signature string `json:"signature"`
+
+	// When Fees is true, this message is requesting the current base fee.
+	Fees bool `json:"fees,omitempty"`
+
+	// When Pending is non-nil, this message is requesting operations that are
+	// not committed yet, and statistics about the operation queue.
+	Pending *PendingQuery `json:"pending,omitempty"`
+
+	// When Status is nonempty, this message is requesting the status of the
+	// operation with this signature, whether it has been committed or not.
+	Status string `json:"status,omitempty"`
 }
 
 func (m *QueryMessage) Slot() int {
@@ -58,12 +73,51 @@ func (m *QueryMessage) String() string {
 	if m.Providers != nil {
 		parts = append(parts, fmt.Sprintf("providers=(%s)", m.Providers))
 	}
+	if m.Payments != nil {
+		parts = append(parts, fmt.Sprintf("payments=(%s)", m.Payments))
+	}
 	if m.Signature != "" {
 		parts = append(parts, fmt.Sprintf("signature=%s", m.Signature))
 	}
+	if m.Fees {
+		parts = append(parts, "fees")
+	}
+	if m.Pending != nil {
+		parts = append(parts, fmt.Sprintf("pending=(%s)", m.Pending))
+	}
+	if m.Status != "" {
+		parts = append(parts, fmt.Sprintf("status=%s", util.Shorten(m.Status)))
+	}
 	return strings.Join(parts, " ")
 }
 
+// QueryType returns a short name for the kind of data being queried.
+func (m *QueryMessage) QueryType() string {
+	switch {
+	case m.Account != "":
+		return "account"
+	case m.Block != 0:
+		return "block"
+	case m.Documents != nil:
+		return "documents"
+	case m.Signature != "":
+		return "signature"
+	case m.Buckets != nil:
+		return "buckets"
+	case m.Providers != nil:
+		return "providers"
+	case m.Payments != nil:
+		return "payments"
+	case m.Fees:
+		return "fees"
+	case m.Pending != nil:
+		return "pending"
+	case m.Status != "":
+		return "status"
+	}
+	return "unknown"
+}
+
 func init() {
 	util.RegisterMessageType(&QueryMessage{})
 }
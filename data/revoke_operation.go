@@ -0,0 +1,69 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// RevokeOperation takes away a trustline's authorization to hold a
+// revocable asset. This freezes its balance until the issuer issues to it
+// again.
+type RevokeOperation struct {
+	// The issuer of the asset
+	Signer string `json:"signer"`
+
+	// The sequence number for this operation
+	Sequence uint32 `json:"sequence"`
+
+	// How much the signer is willing to pay to send this operation through
+	Fee uint64 `json:"fee"`
+
+	// The slots this operation can be processed in
+	Validity
+
+	// The code for the asset
+	Code string `json:"code"`
+
+	// The owner of the trustline to revoke
+	Holder string `json:"holder"`
+}
+
+func (op *RevokeOperation) String() string {
+	return fmt.Sprintf("revoke %s:%s holder=%s",
+		op.Code, util.Shorten(op.Signer), util.Shorten(op.Holder))
+}
+
+func (op *RevokeOperation) OperationType() string {
+	return "Revoke"
+}
+
+func (op *RevokeOperation) GetSigner() string {
+	return op.Signer
+}
+
+func (op *RevokeOperation) GetFee() uint64 {
+	return op.Fee
+}
+
+func (op *RevokeOperation) GetSequence() uint32 {
+	return op.Sequence
+}
+
+func (op *RevokeOperation) Verify() error {
+	if !IsValidAssetCode(op.Code) {
+		return fmt.Errorf("invalid asset code: %s", op.Code)
+	}
+	if _, err := util.ReadPublicKey(op.Holder); err != nil {
+		return fmt.Errorf("invalid holder: %s", op.Holder)
+	}
+	if op.Holder == op.Signer {
+		return errors.New("an issuer has no trustline for its own asset")
+	}
+	return nil
+}
+
+func init() {
+	RegisterOperationType(&RevokeOperation{})
+}
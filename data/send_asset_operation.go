@@ -0,0 +1,81 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// SendAssetOperation sends an asset from one trustline to another.
+// Sending an asset back to its issuer takes it out of circulation.
+type SendAssetOperation struct {
+	// Who is sending the asset
+	Signer string `json:"signer"`
+
+	// The sequence number for this operation
+	Sequence uint32 `json:"sequence"`
+
+	// How much the signer is willing to pay to send this operation through
+	Fee uint64 `json:"fee"`
+
+	// The slots this operation can be processed in
+	Validity
+
+	// Which asset to send
+	Issuer string `json:"issuer"`
+	Code   string `json:"code"`
+
+	// Who is receiving the asset
+	To string `json:"to"`
+
+	Amount uint64 `json:"amount"`
+}
+
+func (op *SendAssetOperation) String() string {
+	return fmt.Sprintf("sendasset %d %s:%s from %s -> %s, seq %d fee %d",
+		op.Amount, op.Code, util.Shorten(op.Issuer), util.Shorten(op.Signer),
+		util.Shorten(op.To), op.Sequence, op.Fee)
+}
+
+func (op *SendAssetOperation) OperationType() string {
+	return "SendAsset"
+}
+
+func (op *SendAssetOperation) GetSigner() string {
+	return op.Signer
+}
+
+func (op *SendAssetOperation) GetFee() uint64 {
+	return op.Fee
+}
+
+func (op *SendAssetOperation) GetSequence() uint32 {
+	return op.Sequence
+}
+
+func (op *SendAssetOperation) Verify() error {
+	if !IsValidAssetCode(op.Code) {
+		return fmt.Errorf("invalid asset code: %s", op.Code)
+	}
+	if _, err := util.ReadPublicKey(op.Issuer); err != nil {
+		return fmt.Errorf("invalid issuer: %s", op.Issuer)
+	}
+	if _, err := util.ReadPublicKey(op.To); err != nil {
+		return fmt.Errorf("cannot send to invalid public key: %s", op.To)
+	}
+	if op.Signer == op.Issuer {
+		return errors.New("an issuer should use an issue operation")
+	}
+	if op.To == op.Signer {
+		return errors.New("cannot send an asset to yourself")
+	}
+	if op.Amount == 0 {
+		return errors.New("cannot send nothing")
+	}
+	return nil
+}
+
+func init() {
+	RegisterOperationType(&SendAssetOperation{})
+}
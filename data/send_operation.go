@@ -23,6 +23,12 @@ type SendOperation struct {
 	// How much the sender is willing to pay to get this transfer registered
 	// This is on top of the amount
 	Fee uint64 `json:"fee"`
+
+	// The slots this operation can be processed in
+	Validity
+
+	// An optional note for the recipient, like which invoice this pays
+	Memo *Memo `json:"memo,omitempty"`
 }
 
 func (op *SendOperation) String() string {
@@ -50,6 +56,9 @@ func (op *SendOperation) Verify() error {
 	if _, err := util.ReadPublicKey(op.To); err != nil {
 		return fmt.Errorf("cannot send to invalid public key: %s", op.To)
 	}
+	if op.Memo != nil {
+		return op.Memo.Check()
+	}
 	return nil
 }
 
@@ -0,0 +1,61 @@
+package data
+
+import (
+	"fmt"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// SetSignersOperation changes which keys control an account.
+// It needs the high threshold, since whoever can do it controls everything.
+type SetSignersOperation struct {
+	// Whose account is changing
+	Signer string `json:"signer"`
+
+	// The sequence number for this operation
+	Sequence uint32 `json:"sequence"`
+
+	// How much the signer is willing to pay to send this operation through
+	Fee uint64 `json:"fee"`
+
+	// The slots this operation can be processed in
+	Validity
+
+	// The new signers and thresholds for the account.
+	// Nil makes the owner key control the account alone again.
+	Auth *AccountAuth `json:"auth"`
+}
+
+func (op *SetSignersOperation) String() string {
+	if op.Auth == nil {
+		return fmt.Sprintf("setsigners owner=%s, reset", util.Shorten(op.Signer))
+	}
+	return fmt.Sprintf("setsigners owner=%s, %s", util.Shorten(op.Signer), op.Auth)
+}
+
+func (op *SetSignersOperation) OperationType() string {
+	return "SetSigners"
+}
+
+func (op *SetSignersOperation) GetSigner() string {
+	return op.Signer
+}
+
+func (op *SetSignersOperation) GetFee() uint64 {
+	return op.Fee
+}
+
+func (op *SetSignersOperation) GetSequence() uint32 {
+	return op.Sequence
+}
+
+func (op *SetSignersOperation) Verify() error {
+	if op.Auth == nil {
+		return nil
+	}
+	return op.Auth.Check()
+}
+
+func init() {
+	RegisterOperationType(&SetSignersOperation{})
+}
@@ -0,0 +1,54 @@
+package data
+
+import (
+	"fmt"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// SettleChannelOperation pays out a channel that the sender closed, once its
+// dispute window is over.
+type SettleChannelOperation struct {
+	// The sender or the recipient of the channel
+	Signer string `json:"signer"`
+
+	// The sequence number for this operation
+	Sequence uint32 `json:"sequence"`
+
+	// How much the signer is willing to pay to send this operation through
+	Fee uint64 `json:"fee"`
+
+	// The slots this operation can be processed in
+	Validity
+
+	// The id of the channel
+	ID uint64 `json:"id"`
+}
+
+func (op *SettleChannelOperation) String() string {
+	return fmt.Sprintf("settlechannel owner=%s, id=%d", util.Shorten(op.Signer), op.ID)
+}
+
+func (op *SettleChannelOperation) OperationType() string {
+	return "SettleChannel"
+}
+
+func (op *SettleChannelOperation) GetSigner() string {
+	return op.Signer
+}
+
+func (op *SettleChannelOperation) GetFee() uint64 {
+	return op.Fee
+}
+
+func (op *SettleChannelOperation) GetSequence() uint32 {
+	return op.Sequence
+}
+
+func (op *SettleChannelOperation) Verify() error {
+	return nil
+}
+
+func init() {
+	RegisterOperationType(&SettleChannelOperation{})
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/lacker/coinkit/util"
 )
@@ -17,6 +19,15 @@ type SignedOperation struct {
 	// The signature to prove that the sender has signed this
 	// Nil if the operation has not been signed
 	Signature string `json:"signature"`
+
+	// The key that made Signature, when it is not the operation's signer.
+	// Accounts with several signers, or whose key was rotated, can be
+	// controlled by keys other than the owner key.
+	SignedBy string `json:"signedBy,omitempty"`
+
+	// Signatures from other keys, keyed by public key.
+	// Together with Signature, these need to meet the signer's threshold.
+	Cosignatures map[string]string `json:"cosignatures,omitempty"`
 }
 
 func NewSignedOperation(op Operation, kp *util.KeyPair) *SignedOperation {
@@ -28,21 +39,85 @@ func NewSignedOperation(op Operation, kp *util.KeyPair) *SignedOperation {
 		util.Logger.Fatal("you can only sign your own operations")
 	}
 
+	return NewSignedOperationWithKey(op, kp)
+}
+
+// NewSignedOperationWithKey signs an operation with a key that need not be
+// the signer's own, like one of the signers of a multisig account.
+// Whether the key is enough to authorize the operation is only checked
+// when the operation is validated.
+func NewSignedOperationWithKey(op Operation, kp *util.KeyPair) *SignedOperation {
+	if op == nil || reflect.ValueOf(op).IsNil() {
+		util.Logger.Fatal("cannot sign nil operation")
+	}
+
 	bytes := util.CanonicalJSONEncode(op)
 	payload := op.OperationType() + string(bytes)
 	sig := kp.Sign(payload)
 
-	return &SignedOperation{
+	answer := &SignedOperation{
 		Operation: op,
 		Type:      op.OperationType(),
 		Signature: sig,
 	}
+	if kp.PublicKey().String() != op.GetSigner() {
+		answer.SignedBy = kp.PublicKey().String()
+	}
+	return answer
+}
+
+// Cosign adds a signature from another key.
+// The operation keeps its Signature, so cosigning does not change which
+// operation this is.
+func (s *SignedOperation) Cosign(kp *util.KeyPair) {
+	bytes := util.CanonicalJSONEncode(s.Operation)
+	payload := s.Type + string(bytes)
+	if s.Cosignatures == nil {
+		s.Cosignatures = make(map[string]string)
+	}
+	s.Cosignatures[kp.PublicKey().String()] = kp.Sign(payload)
+}
+
+// Keys returns the public keys that signed this operation, sorted.
+func (s *SignedOperation) Keys() []string {
+	primary := s.SignedBy
+	if primary == "" {
+		primary = s.GetSigner()
+	}
+	answer := []string{primary}
+	for key, _ := range s.Cosignatures {
+		if key != primary {
+			answer = append(answer, key)
+		}
+	}
+	sort.Strings(answer)
+	return answer
+}
+
+// cosignatureBytes describes who signed the operation other than with the
+// primary signature. It is empty for operations with a single signature.
+func (s *SignedOperation) cosignatureBytes() []byte {
+	if s.SignedBy == "" && len(s.Cosignatures) == 0 {
+		return nil
+	}
+	keys := []string{}
+	for key, _ := range s.Cosignatures {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := []string{"signedBy:" + s.SignedBy}
+	for _, key := range keys {
+		parts = append(parts, key+":"+s.Cosignatures[key])
+	}
+	return []byte(strings.Join(parts, ","))
 }
 
 type partiallyUnmarshaledSignedOperation struct {
-	Operation json.RawMessage `json:"operation"`
-	Type      string          `json:"type"`
-	Signature string          `json:"signature"`
+	Operation    json.RawMessage   `json:"operation"`
+	Type         string            `json:"type"`
+	Signature    string            `json:"signature"`
+	SignedBy     string            `json:"signedBy"`
+	Cosignatures map[string]string `json:"cosignatures"`
 }
 
 func (s *SignedOperation) UnmarshalJSON(data []byte) error {
@@ -52,24 +127,16 @@ func (s *SignedOperation) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	opType, ok := OperationTypeMap[partial.Type]
-	if !ok {
-		return fmt.Errorf("unregistered op type: %s", partial.Type)
-	}
-	op := reflect.New(opType).Interface().(Operation)
-	err = json.Unmarshal(partial.Operation, &op)
-	if err != nil {
-		return err
-	}
-	if op == nil {
-		return fmt.Errorf("decoding a nil operation is not valid")
-	}
-	err = op.Verify()
+	op, err := decodeOperation(partial.Type, partial.Operation)
 	if err != nil {
 		return err
 	}
 
-	pk, err := util.ReadPublicKey(op.GetSigner())
+	primary := op.GetSigner()
+	if partial.SignedBy != "" {
+		primary = partial.SignedBy
+	}
+	pk, err := util.ReadPublicKey(primary)
 	if err != nil {
 		return err
 	}
@@ -78,10 +145,28 @@ func (s *SignedOperation) UnmarshalJSON(data []byte) error {
 		return fmt.Errorf("invalid signature on SignedOperation")
 	}
 
+	if len(partial.Cosignatures) > MaxSigners {
+		return fmt.Errorf("a SignedOperation can have at most %d cosignatures", MaxSigners)
+	}
+	for key, sig := range partial.Cosignatures {
+		pk, err := util.ReadPublicKey(key)
+		if err != nil {
+			return err
+		}
+		if !util.VerifySignature(pk, payload, sig) {
+			return fmt.Errorf("invalid cosignature from %s on SignedOperation", key)
+		}
+	}
+
 	// It's valid
 	s.Operation = op
 	s.Type = partial.Type
 	s.Signature = partial.Signature
+	s.SignedBy = partial.SignedBy
+	s.Cosignatures = partial.Cosignatures
+	if len(s.Cosignatures) == 0 {
+		s.Cosignatures = nil
+	}
 	return nil
 }
 
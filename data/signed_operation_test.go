@@ -75,3 +75,51 @@ func TestSignedOperationDecodingAlsoVerifiesOperation(t *testing.T) {
 		t.Fatal("expected error in decoding")
 	}
 }
+
+func FuzzSignedOperationUnmarshalJSON(f *testing.F) {
+	kp := util.NewKeyPairFromSecretPhrase("fuzz")
+	seeds := []Operation{
+		&SendOperation{Sequence: 1, Amount: 2, Fee: 1, Signer: kp.PublicKey().String()},
+		&CreateDocumentOperation{Sequence: 1, Fee: 1, Signer: kp.PublicKey().String(),
+			Data: NewEmptyJSONObject()},
+	}
+	for _, op := range seeds {
+		f.Add(util.CanonicalJSONEncode(NewSignedOperation(op, kp)))
+	}
+	f.Fuzz(func(t *testing.T, bytes []byte) {
+		so := &SignedOperation{}
+		json.Unmarshal(bytes, so)
+	})
+}
+
+func TestCosignedOperationJson(t *testing.T) {
+	owner := util.NewKeyPairFromSecretPhrase("owner")
+	other := util.NewKeyPairFromSecretPhrase("other")
+	third := util.NewKeyPairFromSecretPhrase("third")
+	op := &TestingOperation{
+		Number: 11,
+		Signer: owner.PublicKey().String(),
+	}
+	so := NewSignedOperationWithKey(op, other)
+	if so.SignedBy != other.PublicKey().String() {
+		t.Fatalf("SignedBy should be set")
+	}
+	so.Cosign(third)
+	bytes := util.CanonicalJSONEncode(so)
+	so2 := &SignedOperation{}
+	err := json.Unmarshal(bytes, so2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := so2.Keys()
+	if len(keys) != 2 {
+		t.Fatalf("expected two keys but got %+v", keys)
+	}
+
+	so.Cosignatures[third.PublicKey().String()] = so.Signature
+	bytes = util.CanonicalJSONEncode(so)
+	err = json.Unmarshal(bytes, &SignedOperation{})
+	if err == nil {
+		t.Fatalf("a bad cosignature should fail to decode")
+	}
+}
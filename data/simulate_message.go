@@ -0,0 +1,132 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// A SimulateMessage asks a node what would happen if some operations were
+// processed on top of the current state, without processing them for real.
+// The operations are simulated in order, so later ones see the effects of
+// earlier ones that succeeded.
+// The response is a SimulationMessage.
+type SimulateMessage struct {
+	Operations []*SignedOperation `json:"operations"`
+}
+
+func (m *SimulateMessage) Slot() int {
+	return 0
+}
+
+func (m *SimulateMessage) MessageType() string {
+	return "Simulate"
+}
+
+func (m *SimulateMessage) String() string {
+	return fmt.Sprintf("simulate %d ops", len(m.Operations))
+}
+
+func (m *SimulateMessage) CheckLimits(encoded []byte, limits *util.MessageLimits) error {
+	var shallow struct {
+		Operations []json.RawMessage `json:"operations"`
+	}
+	err := json.Unmarshal(encoded, &shallow)
+	if err != nil {
+		return err
+	}
+	if limits.MaxOperations > 0 && len(shallow.Operations) > limits.MaxOperations {
+		return &util.LimitError{Kind: "operations", Limit: limits.MaxOperations}
+	}
+	return nil
+}
+
+// A SimulationResult describes what a single operation would do.
+type SimulationResult struct {
+	Signature string `json:"signature"`
+
+	// Error is why the operation would fail. When it is set, nothing else is.
+	Error string `json:"error,omitempty"`
+
+	// The fee the signer would pay
+	Fee uint64 `json:"fee"`
+
+	// The data that the operation would change, in the same format as a
+	// DataMessage. A nil value means the data would be deleted.
+	Accounts  map[string]*Account  `json:"accounts,omitempty"`
+	Documents map[uint64]*Document `json:"documents,omitempty"`
+	Buckets   map[string]*Bucket   `json:"buckets,omitempty"`
+	Providers map[uint64]*Provider `json:"providers,omitempty"`
+
+	ClaimableBalances map[uint64]*ClaimableBalance `json:"claimableBalances,omitempty"`
+	Channels          map[uint64]*Channel          `json:"channels,omitempty"`
+
+	Assets     map[string]*Asset     `json:"assets,omitempty"`
+	Trustlines map[string]*Trustline `json:"trustlines,omitempty"`
+}
+
+// A SimulationMessage is the response to a SimulateMessage, with one result
+// per operation.
+type SimulationMessage struct {
+	// I is the last finalized slot at the time of the simulation.
+	I int `json:"i"`
+
+	Results []*SimulationResult `json:"results"`
+}
+
+func (m *SimulationMessage) Slot() int {
+	return m.I
+}
+
+func (m *SimulationMessage) MessageType() string {
+	return "Simulation"
+}
+
+func (m *SimulationMessage) String() string {
+	parts := []string{"simulation", fmt.Sprintf("slot=%d", m.I)}
+	for _, result := range m.Results {
+		if result.Error != "" {
+			parts = append(parts, fmt.Sprintf("%s=error", util.Shorten(result.Signature)))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s=ok", util.Shorten(result.Signature)))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func init() {
+	util.RegisterMessageType(&SimulateMessage{})
+	util.RegisterMessageType(&SimulationMessage{})
+}
+
+// Simulate processes an operation on a copy-on-write layer over the cache,
+// and describes what changed. The cache itself is never modified.
+func (c *Cache) Simulate(op *SignedOperation) *SimulationResult {
+	result := &SimulationResult{}
+	if op == nil || op.Operation == nil {
+		result.Error = "signed operation has no operation"
+		return result
+	}
+	result.Signature = op.Signature
+	err := op.Operation.Verify()
+	if err == nil {
+		layer := c.CowCopy()
+		err = layer.ProcessSigned(op)
+		if err == nil {
+			result.Fee = op.Operation.GetFee()
+			result.Accounts = layer.accounts
+			result.Documents = layer.documents
+			result.Buckets = layer.buckets
+			result.Providers = layer.providers
+			result.ClaimableBalances = layer.claimables
+			result.Channels = layer.channels
+			result.Assets = layer.assets
+			result.Trustlines = layer.trustlines
+			return result
+		}
+	}
+	result.Error = err.Error()
+	return result
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// SponsoredOperation lets one account pay the fee for another account's
+// operation, so that new users can act before they hold any money.
+// The sponsor is the signer of the SponsoredOperation. It needs to be signed,
+// or cosigned, by enough keys to authorize both the sponsor and the signer
+// of the inner operation.
+// The inner operation still uses up a sequence number for its own signer.
+// If that signer has no account yet, one is created with no balance.
+type SponsoredOperation struct {
+	// Who is paying the fee
+	Signer string `json:"signer"`
+
+	// The sequence number for the sponsor
+	Sequence uint32 `json:"sequence"`
+
+	// The fee, paid by the sponsor. The inner operation has no fee of its own.
+	Fee uint64 `json:"fee"`
+
+	// The slots this operation can be processed in
+	Validity
+
+	// The operation being sponsored
+	Operation *InnerOperation `json:"operation"`
+}
+
+func (op *SponsoredOperation) String() string {
+	return fmt.Sprintf("sponsored by=%s, seq=%d, fee=%d: (%s)",
+		util.Shorten(op.Signer), op.Sequence, op.Fee, op.Operation.Operation.String())
+}
+
+func (op *SponsoredOperation) OperationType() string {
+	return "Sponsored"
+}
+
+func (op *SponsoredOperation) GetSigner() string {
+	return op.Signer
+}
+
+func (op *SponsoredOperation) GetFee() uint64 {
+	return op.Fee
+}
+
+func (op *SponsoredOperation) GetSequence() uint32 {
+	return op.Sequence
+}
+
+func (op *SponsoredOperation) Verify() error {
+	if op.Operation == nil || op.Operation.Operation == nil {
+		return errors.New("a sponsored operation needs an operation to sponsor")
+	}
+	if op.Operation.GetSigner() == op.Signer {
+		return errors.New("an account cannot sponsor itself")
+	}
+	return op.Operation.verifyFeeless()
+}
+
+func init() {
+	RegisterOperationType(&SponsoredOperation{})
+}
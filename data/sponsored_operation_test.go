@@ -0,0 +1,47 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/lacker/coinkit/util"
+)
+
+func TestSponsoredOperation(t *testing.T) {
+	sponsor := util.NewKeyPairFromSecretPhrase("sponsor")
+	user := util.NewKeyPairFromSecretPhrase("newuser")
+	c := NewCache()
+	c.SetBalance(sponsor.PublicKey().String(), 100)
+	c.BaseFee = 2
+
+	data := NewEmptyJSONObject()
+	data.Set("foo", 1)
+	op := NewSignedOperation(&SponsoredOperation{
+		Signer:   sponsor.PublicKey().String(),
+		Sequence: 1,
+		Fee:      2,
+		Operation: NewInnerOperation(&CreateDocumentOperation{
+			Signer:   user.PublicKey().String(),
+			Sequence: 1,
+			Data:     data,
+		}),
+	}, sponsor)
+	if c.ValidateSigned(op) == nil {
+		t.Fatalf("the user should have to sign too")
+	}
+
+	op.Cosign(user)
+	err := c.ProcessSigned(op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.GetDocument(1) == nil || c.DocOwner(1) != user.PublicKey().String() {
+		t.Fatalf("the document should have been created for the user")
+	}
+	account := c.GetAccount(user.PublicKey().String())
+	if account == nil || account.Sequence != 1 || account.Balance != 0 {
+		t.Fatalf("unexpected user account: %+v", account)
+	}
+	if c.GetAccount(sponsor.PublicKey().String()).Balance != 98 {
+		t.Fatalf("the sponsor should have paid the fee")
+	}
+}
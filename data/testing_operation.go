@@ -8,6 +8,8 @@ type TestingOperation struct {
 	Number  int    `json:"number"`
 	Signer  string `json:"signer"`
 	Invalid bool   `json:"invalid"`
+
+	Validity
 }
 
 func (op *TestingOperation) OperationType() string {
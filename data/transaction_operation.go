@@ -0,0 +1,134 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// MaxTransactionSize is the most operations a single transaction can hold.
+const MaxTransactionSize = 20
+
+// An InnerOperation is an operation inside a transaction.
+// It is not signed on its own. Instead, the signatures on the transaction
+// cover every operation in it.
+type InnerOperation struct {
+	Operation `json:"operation"`
+
+	// The type of the operation
+	Type string `json:"type"`
+}
+
+func NewInnerOperation(op Operation) *InnerOperation {
+	return &InnerOperation{
+		Operation: op,
+		Type:      op.OperationType(),
+	}
+}
+
+func (o *InnerOperation) UnmarshalJSON(data []byte) error {
+	var partial struct {
+		Operation json.RawMessage `json:"operation"`
+		Type      string          `json:"type"`
+	}
+	err := json.Unmarshal(data, &partial)
+	if err != nil {
+		return err
+	}
+	op, err := decodeOperation(partial.Type, partial.Operation)
+	if err != nil {
+		return err
+	}
+	o.Operation = op
+	o.Type = partial.Type
+	return nil
+}
+
+// verifyFeeless checks an operation that goes inside an envelope, like a
+// transaction, which pays its fee for it.
+func (o *InnerOperation) verifyFeeless() error {
+	switch o.Operation.(type) {
+	case *TransactionOperation, *SponsoredOperation:
+		return errors.New("envelope operations cannot be nested")
+	}
+	if o.Operation.GetFee() != 0 {
+		return errors.New("an operation inside an envelope cannot have its own fee")
+	}
+	return o.Operation.Verify()
+}
+
+// TransactionOperation groups several operations, possibly from several
+// signers, so that either all of them are processed or none are.
+// The transaction needs to be signed, or cosigned, by enough keys to
+// authorize each operation in it for its own signer.
+// Every operation in it still uses up a sequence number for its signer, so
+// when the transaction signer has operations inside the transaction, they
+// come right after the transaction's own sequence number.
+type TransactionOperation struct {
+	// Who is paying for the transaction
+	Signer string `json:"signer"`
+
+	// The sequence number for this operation
+	Sequence uint32 `json:"sequence"`
+
+	// The fee for the whole transaction. The operations inside it have no
+	// fees of their own.
+	Fee uint64 `json:"fee"`
+
+	// The slots this operation can be processed in
+	Validity
+
+	// The operations to process, in order
+	Operations []*InnerOperation `json:"operations"`
+}
+
+func (op *TransactionOperation) String() string {
+	parts := []string{}
+	for _, inner := range op.Operations {
+		parts = append(parts, inner.Operation.String())
+	}
+	return fmt.Sprintf("transaction owner=%s, seq=%d, fee=%d: (%s)",
+		util.Shorten(op.Signer), op.Sequence, op.Fee, strings.Join(parts, "; "))
+}
+
+func (op *TransactionOperation) OperationType() string {
+	return "Transaction"
+}
+
+func (op *TransactionOperation) GetSigner() string {
+	return op.Signer
+}
+
+func (op *TransactionOperation) GetFee() uint64 {
+	return op.Fee
+}
+
+func (op *TransactionOperation) GetSequence() uint32 {
+	return op.Sequence
+}
+
+func (op *TransactionOperation) Verify() error {
+	if len(op.Operations) == 0 {
+		return errors.New("a transaction needs at least one operation")
+	}
+	if len(op.Operations) > MaxTransactionSize {
+		return fmt.Errorf("a transaction can have at most %d operations", MaxTransactionSize)
+	}
+	for i, inner := range op.Operations {
+		if inner == nil || inner.Operation == nil {
+			return fmt.Errorf("operation %d in the transaction is nil", i)
+		}
+		err := inner.verifyFeeless()
+		if err != nil {
+			return fmt.Errorf("operation %d in the transaction: %s", i, err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	RegisterOperationType(&TransactionOperation{})
+}
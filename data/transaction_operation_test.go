@@ -0,0 +1,119 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/lacker/coinkit/util"
+)
+
+func makeTestTransaction(fee uint64, ops ...Operation) (*SignedOperation, *util.KeyPair, *util.KeyPair) {
+	alice := util.NewKeyPairFromSecretPhrase("alice")
+	bob := util.NewKeyPairFromSecretPhrase("bob")
+	t := &TransactionOperation{
+		Signer:   alice.PublicKey().String(),
+		Sequence: 1,
+		Fee:      fee,
+	}
+	for _, op := range ops {
+		t.Operations = append(t.Operations, NewInnerOperation(op))
+	}
+	so := NewSignedOperation(t, alice)
+	so.Cosign(bob)
+	return so, alice, bob
+}
+
+func TestTransactionJson(t *testing.T) {
+	alice := util.NewKeyPairFromSecretPhrase("alice").PublicKey().String()
+	bob := util.NewKeyPairFromSecretPhrase("bob").PublicKey().String()
+	so, _, _ := makeTestTransaction(3,
+		&SendOperation{Signer: alice, Sequence: 2, To: bob, Amount: 10},
+		&SendOperation{Signer: bob, Sequence: 1, To: alice, Amount: 5})
+	bytes := util.CanonicalJSONEncode(so)
+	so2 := &SignedOperation{}
+	err := json.Unmarshal(bytes, so2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := so2.Operation.(*TransactionOperation).Operations
+	if len(inner) != 2 || inner[1].Operation.(*SendOperation).Amount != 5 {
+		t.Fatalf("bad decoding: %+v", so2.Operation)
+	}
+}
+
+func TestTransactionVerify(t *testing.T) {
+	alice := util.NewKeyPairFromSecretPhrase("alice").PublicKey().String()
+	bob := util.NewKeyPairFromSecretPhrase("bob").PublicKey().String()
+	send := &SendOperation{Signer: alice, Sequence: 2, To: bob, Amount: 10}
+	good := &TransactionOperation{
+		Signer:     alice,
+		Sequence:   1,
+		Operations: []*InnerOperation{NewInnerOperation(send)},
+	}
+	if err := good.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	nested := &TransactionOperation{
+		Signer:     alice,
+		Sequence:   1,
+		Operations: []*InnerOperation{NewInnerOperation(good)},
+	}
+	if nested.Verify() == nil {
+		t.Fatalf("nested transactions should not verify")
+	}
+	send.Fee = 1
+	if good.Verify() == nil {
+		t.Fatalf("inner operations with fees should not verify")
+	}
+}
+
+func TestTransactionProcessing(t *testing.T) {
+	alice := util.NewKeyPairFromSecretPhrase("alice").PublicKey().String()
+	bob := util.NewKeyPairFromSecretPhrase("bob").PublicKey().String()
+	c := NewCache()
+	c.SetBalance(alice, 100)
+	c.SetBalance(bob, 100)
+
+	// The last operation sends more than bob has, so nothing should happen
+	bad, _, _ := makeTestTransaction(3,
+		&CreateBucketOperation{Signer: alice, Sequence: 2, Name: "alicebucket", Size: 10},
+		&SendOperation{Signer: alice, Sequence: 3, To: bob, Amount: 10},
+		&SendOperation{Signer: bob, Sequence: 1, To: alice, Amount: 500})
+	if c.ProcessSigned(bad) == nil {
+		t.Fatalf("the bad transaction should fail")
+	}
+	if c.BucketExists("alicebucket") || c.GetAccount(alice).Balance != 100 ||
+		c.GetAccount(alice).Sequence != 0 {
+		t.Fatalf("a failed transaction should not change anything")
+	}
+
+	good, alicekp, _ := makeTestTransaction(3,
+		&CreateBucketOperation{Signer: alice, Sequence: 2, Name: "alicebucket", Size: 10},
+		&SendOperation{Signer: alice, Sequence: 3, To: bob, Amount: 10},
+		&SendOperation{Signer: bob, Sequence: 1, To: alice, Amount: 50})
+	err := c.ProcessSigned(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.BucketExists("alicebucket") {
+		t.Fatalf("the bucket should have been created")
+	}
+	a := c.GetAccount(alice)
+	if a.Balance != 137 || a.Sequence != 3 {
+		t.Fatalf("unexpected account: %+v", a)
+	}
+	if c.GetAccount(bob).Balance != 60 {
+		t.Fatalf("unexpected account: %+v", c.GetAccount(bob))
+	}
+
+	// Without bob's signature, alice cannot spend bob's money
+	theft := NewSignedOperation(&TransactionOperation{
+		Signer:   alice,
+		Sequence: 4,
+		Operations: []*InnerOperation{NewInnerOperation(
+			&SendOperation{Signer: bob, Sequence: 2, To: alice, Amount: 50})},
+	}, alicekp)
+	if c.ValidateSigned(theft) == nil {
+		t.Fatalf("a transaction needs the signatures of every signer in it")
+	}
+}
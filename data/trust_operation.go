@@ -0,0 +1,75 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/lacker/coinkit/util"
+)
+
+// TrustOperation creates a trustline so that the signer can hold an asset,
+// or changes its limit. A limit of zero removes a trustline with nothing
+// left in it.
+type TrustOperation struct {
+	// Who will hold the asset
+	Signer string `json:"signer"`
+
+	// The sequence number for this operation
+	Sequence uint32 `json:"sequence"`
+
+	// How much the signer is willing to pay to send this operation through
+	Fee uint64 `json:"fee"`
+
+	// The slots this operation can be processed in
+	Validity
+
+	// Which asset to trust
+	Issuer string `json:"issuer"`
+	Code   string `json:"code"`
+
+	// The most of the asset the signer is willing to hold
+	Limit uint64 `json:"limit"`
+}
+
+func (op *TrustOperation) String() string {
+	return fmt.Sprintf("trust %s:%s owner=%s, limit=%d",
+		op.Code, util.Shorten(op.Issuer), util.Shorten(op.Signer), op.Limit)
+}
+
+func (op *TrustOperation) OperationType() string {
+	return "Trust"
+}
+
+func (op *TrustOperation) GetSigner() string {
+	return op.Signer
+}
+
+func (op *TrustOperation) GetFee() uint64 {
+	return op.Fee
+}
+
+func (op *TrustOperation) GetSequence() uint32 {
+	return op.Sequence
+}
+
+func (op *TrustOperation) Verify() error {
+	if !IsValidAssetCode(op.Code) {
+		return fmt.Errorf("invalid asset code: %s", op.Code)
+	}
+	if _, err := util.ReadPublicKey(op.Issuer); err != nil {
+		return fmt.Errorf("invalid issuer: %s", op.Issuer)
+	}
+	if op.Issuer == op.Signer {
+		return errors.New("an issuer does not need a trustline for its own asset")
+	}
+	// The database stores limits as signed 64-bit integers
+	if op.Limit > math.MaxInt64 {
+		return fmt.Errorf("a trustline limit cannot be more than %d", int64(math.MaxInt64))
+	}
+	return nil
+}
+
+func init() {
+	RegisterOperationType(&TrustOperation{})
+}
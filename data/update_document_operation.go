@@ -18,6 +18,9 @@ type UpdateDocumentOperation struct {
 	// How much the updater is willing to pay to send this operation through
 	Fee uint64 `json:"fee"`
 
+	// The slots this operation can be processed in
+	Validity
+
 	// The id of the document to update
 	ID uint64 `json:"id"`
 
@@ -51,6 +54,9 @@ func (op *UpdateDocumentOperation) GetData() *JSONObject {
 }
 
 func (op *UpdateDocumentOperation) Verify() error {
+	if op.Data == nil {
+		return fmt.Errorf("document operations must have data")
+	}
 	return nil
 }
 
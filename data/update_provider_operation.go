@@ -16,6 +16,9 @@ type UpdateProviderOperation struct {
 	// The operation fee for entering an op into the blockchain
 	Fee uint64 `json:"fee"`
 
+	// The slots this operation can be processed in
+	Validity
+
 	// The ID of the provider to update
 	ID uint64 `json:"id"`
 
@@ -0,0 +1,56 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A Validity limits which slots an operation can be processed in, so that an
+// operation that was not processed in time cannot be replayed into a later
+// block. Zero means there is no limit.
+// The ledger has no clock, so the window is measured in slots.
+type Validity struct {
+	// The first slot the operation can be processed in
+	MinSlot int `json:"minSlot,omitempty"`
+
+	// The last slot the operation can be processed in
+	MaxSlot int `json:"maxSlot,omitempty"`
+}
+
+func (v Validity) GetValidity() Validity {
+	return v
+}
+
+func (v Validity) String() string {
+	if v.MaxSlot == 0 {
+		return fmt.Sprintf("slots %d-", v.MinSlot)
+	}
+	return fmt.Sprintf("slots %d-%d", v.MinSlot, v.MaxSlot)
+}
+
+// Check returns an error if no slot is in this window.
+func (v Validity) Check() error {
+	if v.MinSlot < 0 || v.MaxSlot < 0 {
+		return errors.New("validity slots cannot be negative")
+	}
+	if v.MaxSlot != 0 && v.MaxSlot < v.MinSlot {
+		return fmt.Errorf("the validity window %s is empty", v)
+	}
+	return nil
+}
+
+// Expired returns whether the window is over by this slot.
+func (v Validity) Expired(slot int) bool {
+	return v.MaxSlot != 0 && slot > v.MaxSlot
+}
+
+// ValidAt returns an error unless this slot is in the window.
+func (v Validity) ValidAt(slot int) error {
+	if slot < v.MinSlot {
+		return fmt.Errorf("the operation is not valid until slot %d", v.MinSlot)
+	}
+	if v.Expired(slot) {
+		return fmt.Errorf("the operation expired after slot %d", v.MaxSlot)
+	}
+	return nil
+}
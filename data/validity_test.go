@@ -0,0 +1,78 @@
+package data
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/lacker/coinkit/util"
+)
+
+func TestValidityWindow(t *testing.T) {
+	q := NewTestingOperationQueue()
+	q.slot = 10
+	q.cache.Slot = 10
+	kp := util.NewKeyPairFromSecretPhrase("window")
+	dest := util.NewKeyPairFromSecretPhrase("destination").PublicKey().String()
+	q.cache.SetBalance(kp.PublicKey().String(), 100)
+	send := func(min int, max int) *SignedOperation {
+		return NewSignedOperation(&SendOperation{
+			Signer:   kp.PublicKey().String(),
+			Sequence: 1,
+			To:       dest,
+			Amount:   1,
+			Fee:      uint64(1 + min + max),
+			Validity: Validity{MinSlot: min, MaxSlot: max},
+		}, kp)
+	}
+
+	if q.Add(send(q.slot+1, 0)) {
+		t.Fatalf("an operation should not be accepted before its window")
+	}
+	if q.Add(send(0, q.slot-1)) {
+		t.Fatalf("an operation should not be accepted after its window")
+	}
+	op := send(q.slot, q.slot+1)
+	if !q.Add(op) {
+		t.Fatalf("an operation should be accepted during its window")
+	}
+
+	q.slot += 2
+	q.cache.Slot += 2
+	q.Revalidate()
+	if q.Contains(op) {
+		t.Fatalf("the operation should have been purged")
+	}
+	if q.Statuses.Get(op.Signature).State != StatusExpired {
+		t.Fatalf("the operation should be marked as expired")
+	}
+	if q.cache.ValidateSigned(op) == nil {
+		t.Fatalf("an expired operation should not be valid in a block")
+	}
+}
+
+func TestValidityJson(t *testing.T) {
+	kp := util.NewKeyPairFromSecretPhrase("window")
+	op := makeTestSendOperation(1).Operation.(*SendOperation)
+	op.Signer = kp.PublicKey().String()
+	bytes := util.CanonicalJSONEncode(NewSignedOperation(op, kp))
+	if strings.Contains(string(bytes), "Slot") {
+		t.Fatalf("an empty window should not change the encoding: %s", bytes)
+	}
+
+	op.Validity = Validity{MinSlot: 5, MaxSlot: 9}
+	decoded := &SignedOperation{}
+	err := json.Unmarshal(util.CanonicalJSONEncode(NewSignedOperation(op, kp)), decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.GetValidity() != op.Validity {
+		t.Fatalf("the window did not survive encoding: %+v", decoded.GetValidity())
+	}
+
+	op.Validity = Validity{MinSlot: 9, MaxSlot: 5}
+	err = json.Unmarshal(util.CanonicalJSONEncode(NewSignedOperation(op, kp)), decoded)
+	if err == nil {
+		t.Fatalf("an empty window should not decode")
+	}
+}
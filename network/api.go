@@ -0,0 +1,470 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lacker/coinkit/data"
+	"github.com/lacker/coinkit/util"
+)
+
+// The JSON API lives under /v1/ and lets clients read the ledger and submit
+// operations without building signed messages.
+//
+// GET  /v1/accounts/{key}
+// GET  /v1/blocks/{slot}
+// GET  /v1/operations/{signature}
+// GET  /v1/statuses/{signature}, for operations that may not be committed.
+//      Statuses are kept in memory, so after a restart, operations are unknown
+//      unless they are in a recent block.
+// GET  /v1/pending?signer=&type=&minFee=&limit=
+// GET  /v1/fees
+// GET  /v1/documents?data={json}&limit={n}
+// GET  /v1/buckets?name=&owner=&provider=&limit=
+// GET  /v1/providers?id=&owner=&available=&bucket=&limit=
+// GET  /v1/payments?recipient=&memo=&limit=, with memos written like id:123
+// POST /v1/operations with a signed operation, or a list of them
+// POST /v1/simulate with the same body, to see what the operations would do
+//
+// Failures are reported as an error object with a non-200 status code.
+
+// APIError is the body of any API response that failed.
+type APIError struct {
+	Error string `json:"error"`
+
+	// When RetryAfter is nonzero, the server was too busy, and the request
+	// can be retried after this many milliseconds.
+	RetryAfter int `json:"retryAfter,omitempty"`
+}
+
+// APIOperationResult describes what happened to a single submitted operation.
+type APIOperationResult struct {
+	Signature string `json:"signature"`
+
+	// Status is "pending" when the operation was accepted into the queue,
+	// "busy" when it should be retried later, and "rejected" otherwise.
+	Status string `json:"status"`
+
+	Error      string `json:"error,omitempty"`
+	RetryAfter int    `json:"retryAfter,omitempty"`
+}
+
+// writeJSON encodes canonically, so that signed operations in the response
+// can be decoded and verified.
+func writeJSON(w http.ResponseWriter, status int, x interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(util.CanonicalJSONEncode(x))
+	w.Write([]byte("\n"))
+}
+
+func writeAPIError(w http.ResponseWriter, status int, format string, a ...interface{}) {
+	writeJSON(w, status, &APIError{Error: fmt.Sprintf(format, a...)})
+}
+
+// handleAPI routes everything under /v1/.
+func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/"), "/"), "/", 2)
+	resource := parts[0]
+	arg := ""
+	if len(parts) == 2 {
+		arg = parts[1]
+	}
+	// Signatures are base64, so they can contain slashes
+	if strings.Contains(arg, "/") && resource != "operations" && resource != "statuses" {
+		writeAPIError(w, http.StatusNotFound, "no such path: %s", r.URL.Path)
+		return
+	}
+
+	if resource == "operations" && arg == "" {
+		if r.Method != http.MethodPost {
+			writeAPIError(w, http.StatusMethodNotAllowed, "operations must be POSTed")
+			return
+		}
+		s.handleAPISubmit(w, r)
+		return
+	}
+	if resource == "simulate" && arg == "" {
+		if r.Method != http.MethodPost {
+			writeAPIError(w, http.StatusMethodNotAllowed, "simulations must be POSTed")
+			return
+		}
+		s.handleAPISimulate(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "%s only supports GET", resource)
+		return
+	}
+	if resource == "statuses" && arg != "" {
+		// This works without a database, but then only knows what is in memory
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": s.getStatus(arg)})
+		return
+	}
+	if resource == "pending" && arg == "" {
+		s.handleAPIPending(w, r)
+		return
+	}
+	query, err := apiQuery(resource, arg, r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+	if query == nil {
+		writeAPIError(w, http.StatusNotFound, "no such path: %s", r.URL.Path)
+		return
+	}
+	if s.db == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, "this server has no database")
+		return
+	}
+	dm, err := s.db.HandleQueryMessage(query)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+
+	switch resource {
+	case "accounts":
+		account := dm.Accounts[arg]
+		if account == nil {
+			writeAPIError(w, http.StatusNotFound, "no account for %s", arg)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"i":                 dm.I,
+			"account":           account,
+			"claimableBalances": dm.ClaimableBalances,
+			"channels":          dm.Channels,
+			"assets":            dm.Assets,
+			"trustlines":        dm.Trustlines,
+		})
+	case "blocks":
+		block := dm.Blocks[query.Block]
+		if block == nil {
+			writeAPIError(w, http.StatusNotFound, "block %d is not finalized", query.Block)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"block": block})
+	case "operations":
+		op := dm.Operations[arg]
+		if op == nil {
+			writeAPIError(w, http.StatusNotFound, "no committed operation with signature %s", arg)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"operation": op})
+	case "fees":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"i": dm.I, "baseFee": dm.BaseFee})
+	case "documents":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"i": dm.I, "documents": dm.Documents})
+	case "buckets":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"i": dm.I, "buckets": dm.Buckets})
+	case "providers":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"i": dm.I, "providers": dm.Providers})
+	case "payments":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"i": dm.I, "payments": dm.Payments})
+	}
+}
+
+// apiQuery converts a GET request into the equivalent query message.
+// It returns nil if there is no such query.
+func apiQuery(resource string, arg string, r *http.Request) (*data.QueryMessage, error) {
+	v := r.URL.Query()
+	switch resource {
+	case "accounts":
+		if arg == "" {
+			return nil, nil
+		}
+		return &data.QueryMessage{Account: arg}, nil
+
+	case "blocks":
+		if arg == "" {
+			return nil, nil
+		}
+		slot, err := strconv.Atoi(arg)
+		if err != nil || slot < 1 {
+			return nil, fmt.Errorf("bad slot: %s", arg)
+		}
+		return &data.QueryMessage{Block: slot}, nil
+
+	case "operations":
+		if arg == "" {
+			return nil, nil
+		}
+		return &data.QueryMessage{Signature: arg}, nil
+
+	case "fees":
+		if arg != "" {
+			return nil, nil
+		}
+		return &data.QueryMessage{Fees: true}, nil
+
+	case "documents":
+		if arg != "" {
+			return nil, nil
+		}
+		q := &data.DocumentQuery{Data: data.NewEmptyJSONObject()}
+		if v.Get("data") != "" {
+			ob, err := data.ReadJSONObject([]byte(v.Get("data")))
+			if err != nil {
+				return nil, fmt.Errorf("bad data: %s", err)
+			}
+			q.Data = ob
+		}
+		limit, err := intParam(v.Get("limit"))
+		if err != nil {
+			return nil, err
+		}
+		q.Limit = int(limit)
+		return &data.QueryMessage{Documents: q}, nil
+
+	case "buckets":
+		if arg != "" {
+			return nil, nil
+		}
+		q := &data.BucketQuery{
+			Name:  v.Get("name"),
+			Owner: v.Get("owner"),
+		}
+		provider, err := intParam(v.Get("provider"))
+		if err != nil {
+			return nil, err
+		}
+		q.Provider = provider
+		limit, err := intParam(v.Get("limit"))
+		if err != nil {
+			return nil, err
+		}
+		q.Limit = int(limit)
+		return &data.QueryMessage{Buckets: q}, nil
+
+	case "providers":
+		if arg != "" {
+			return nil, nil
+		}
+		q := &data.ProviderQuery{
+			Owner:  v.Get("owner"),
+			Bucket: v.Get("bucket"),
+		}
+		id, err := intParam(v.Get("id"))
+		if err != nil {
+			return nil, err
+		}
+		q.ID = id
+		available, err := intParam(v.Get("available"))
+		if err != nil {
+			return nil, err
+		}
+		q.Available = uint32(available)
+		limit, err := intParam(v.Get("limit"))
+		if err != nil {
+			return nil, err
+		}
+		q.Limit = int(limit)
+		return &data.QueryMessage{Providers: q}, nil
+
+	case "payments":
+		if arg != "" {
+			return nil, nil
+		}
+		q := &data.PaymentQuery{Recipient: v.Get("recipient")}
+		if q.Recipient == "" {
+			return nil, fmt.Errorf("payments need a recipient")
+		}
+		if v.Get("memo") != "" {
+			memo, err := data.ParseMemo(v.Get("memo"))
+			if err != nil {
+				return nil, err
+			}
+			q.Memo = memo
+		}
+		limit, err := intParam(v.Get("limit"))
+		if err != nil {
+			return nil, err
+		}
+		q.Limit = int(limit)
+		return &data.QueryMessage{Payments: q}, nil
+	}
+	return nil, nil
+}
+
+// intParam parses an optional nonnegative integer query parameter.
+func intParam(s string) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad integer parameter: %s", s)
+	}
+	return n, nil
+}
+
+// readAPIOperations reads a signed operation, or a list of them, from the
+// request body. If it fails, it responds with an error and returns false.
+func (s *Server) readAPIOperations(w http.ResponseWriter, r *http.Request) ([]*data.SignedOperation, bool) {
+	body := r.Body
+	if s.Limits.MaxLineSize > 0 {
+		body = http.MaxBytesReader(w, body, int64(s.Limits.MaxLineSize))
+	}
+	bs, err := ioutil.ReadAll(body)
+	if err != nil {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, "%s", err)
+		return nil, false
+	}
+	err = util.CheckJSONDepth(bs, s.Limits.MaxJSONDepth)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%s", err)
+		return nil, false
+	}
+
+	ops := []*data.SignedOperation{}
+	trimmed := bytes.TrimSpace(bs)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &ops)
+	} else {
+		op := &data.SignedOperation{}
+		err = json.Unmarshal(trimmed, op)
+		ops = append(ops, op)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid signed operation: %s", err)
+		return nil, false
+	}
+	if len(ops) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "no operations provided")
+		return nil, false
+	}
+	if s.Limits.MaxOperations > 0 && len(ops) > s.Limits.MaxOperations {
+		writeAPIError(w, http.StatusBadRequest, "%s",
+			&util.LimitError{Kind: "operations", Limit: s.Limits.MaxOperations})
+		return nil, false
+	}
+	return ops, true
+}
+
+// handleAPISubmit accepts either a single signed operation or a list of them.
+// Each operation is submitted on its own, so that each gets its own result.
+func (s *Server) handleAPISubmit(w http.ResponseWriter, r *http.Request) {
+	ops, ok := s.readAPIOperations(w, r)
+	if !ok {
+		return
+	}
+
+	results := []*APIOperationResult{}
+	for _, op := range ops {
+		result, ok := s.submitOperation(op)
+		if !ok {
+			writeAPIError(w, http.StatusServiceUnavailable, "the server is shutting down")
+			return
+		}
+		results = append(results, result)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+}
+
+// handleAPIPending asks the node for the operations in its queue.
+func (s *Server) handleAPIPending(w http.ResponseWriter, r *http.Request) {
+	v := r.URL.Query()
+	q := &data.PendingQuery{
+		Signer: v.Get("signer"),
+		Type:   v.Get("type"),
+	}
+	minFee, err := intParam(v.Get("minFee"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+	q.MinFee = minFee
+	limit, err := intParam(v.Get("limit"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+	q.Limit = int(limit)
+
+	sm := util.NewSignedMessage(&data.QueryMessage{Pending: q}, s.apiKeyPair)
+	response, ok := s.handleMessage(sm)
+	if !ok {
+		writeAPIError(w, http.StatusServiceUnavailable, "the server is shutting down")
+		return
+	}
+	switch m := response.Message().(type) {
+	case *data.DataMessage:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"i":       m.I,
+			"pending": m.Pending,
+			"stats":   m.QueueStats,
+		})
+	case *util.ErrorMessage:
+		writeJSON(w, http.StatusServiceUnavailable, &APIError{Error: m.Error, RetryAfter: m.RetryAfter})
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "unexpected response: %s", m)
+	}
+}
+
+// handleAPISimulate asks the node what some operations would do, without
+// submitting them.
+func (s *Server) handleAPISimulate(w http.ResponseWriter, r *http.Request) {
+	ops, ok := s.readAPIOperations(w, r)
+	if !ok {
+		return
+	}
+	sm := util.NewSignedMessage(&data.SimulateMessage{Operations: ops}, s.apiKeyPair)
+	response, ok := s.handleMessage(sm)
+	if !ok {
+		writeAPIError(w, http.StatusServiceUnavailable, "the server is shutting down")
+		return
+	}
+	switch m := response.Message().(type) {
+	case *data.SimulationMessage:
+		writeJSON(w, http.StatusOK, m)
+	case *util.ErrorMessage:
+		writeJSON(w, http.StatusServiceUnavailable, &APIError{Error: m.Error, RetryAfter: m.RetryAfter})
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "unexpected response: %s", m)
+	}
+}
+
+// submitOperation sends a single operation to the node.
+// It returns false if the server is shutting down.
+func (s *Server) submitOperation(op *data.SignedOperation) (*APIOperationResult, bool) {
+	result := &APIOperationResult{}
+	if op == nil || op.Operation == nil {
+		result.Status = "rejected"
+		result.Error = "signed operation has no operation"
+		return result, true
+	}
+	result.Signature = op.Signature
+
+	// The node ignores messages that claim to come from itself, so we sign
+	// with a key of our own for the API.
+	sm := util.NewSignedMessage(data.NewOperationMessage(op), s.apiKeyPair)
+	response, ok := s.handleMessage(sm)
+	if !ok {
+		return nil, false
+	}
+	if response == nil {
+		result.Status = "pending"
+		return result, true
+	}
+	em, ok := response.Message().(*util.ErrorMessage)
+	if !ok {
+		result.Status = "pending"
+		return result, true
+	}
+	if em.IsBusy() {
+		result.Status = "busy"
+		result.RetryAfter = em.RetryAfter
+	} else {
+		result.Status = "rejected"
+	}
+	result.Error = em.Error
+	return result, true
+}
@@ -0,0 +1,212 @@
+package network
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lacker/coinkit/data"
+	"github.com/lacker/coinkit/util"
+)
+
+func apiRequest(s *Server, method string, path string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	s.handleAPI(w, r)
+	return w
+}
+
+func TestAPIWithoutDatabase(t *testing.T) {
+	config, kps := NewUnitTestNetwork()
+	s := NewServer(kps[0], config, nil)
+
+	w := apiRequest(s, "GET", "/v1/accounts/foo", "")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 but got %d", w.Code)
+	}
+	w = apiRequest(s, "GET", "/v1/nonsense", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 but got %d", w.Code)
+	}
+	w = apiRequest(s, "GET", "/v1/blocks/zero", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 but got %d", w.Code)
+	}
+}
+
+func TestWriteJSONKeepsSignaturesValid(t *testing.T) {
+	kp := util.NewKeyPairFromSecretPhrase("alice")
+	op := data.NewSignedOperation(&data.SendOperation{
+		Signer:   kp.PublicKey().String(),
+		Sequence: 1,
+		To:       util.NewKeyPairFromSecretPhrase("bob").PublicKey().String(),
+		Amount:   10,
+		Fee:      1,
+	}, kp)
+	w := httptest.NewRecorder()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"operation": op})
+	var response struct {
+		Operation *data.SignedOperation `json:"operation"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("the operation in the response did not verify: %s", err)
+	}
+	if response.Operation.Signature != op.Signature {
+		t.Fatalf("got the wrong operation back: %s", w.Body)
+	}
+}
+
+func TestAPISubmit(t *testing.T) {
+	config, kps := NewUnitTestNetwork()
+	s := NewServer(kps[0], config, nil)
+	go s.processMessagesForever()
+	defer s.Stop()
+
+	kp := util.NewKeyPairFromSecretPhrase("client")
+	s.setBalance(kp.PublicKey().String(), 100)
+	op := data.NewSignedOperation(&data.SendOperation{
+		Signer:   kp.PublicKey().String(),
+		Sequence: 1,
+		To:       util.NewKeyPairFromSecretPhrase("bob").PublicKey().String(),
+		Amount:   10,
+		Fee:      1,
+	}, kp)
+	body := string(util.CanonicalJSONEncode(op))
+
+	results := func(w *httptest.ResponseRecorder) []*APIOperationResult {
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200 but got %d: %s", w.Code, w.Body)
+		}
+		var response struct {
+			Results []*APIOperationResult `json:"results"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(response.Results) != 1 {
+			t.Fatalf("expected one result but got %s", w.Body)
+		}
+		return response.Results
+	}
+
+	r := results(apiRequest(s, "POST", "/v1/operations", body))
+	if r[0].Status != "pending" || r[0].Signature != op.Signature {
+		t.Fatalf("unexpected result: %+v", r[0])
+	}
+
+	r = results(apiRequest(s, "POST", "/v1/operations", "["+body+"]"))
+	if r[0].Status != "rejected" || !strings.Contains(r[0].Error, "already pending") {
+		t.Fatalf("unexpected result: %+v", r[0])
+	}
+
+	w := apiRequest(s, "POST", "/v1/operations", `{"bad":"op"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 but got %d", w.Code)
+	}
+
+	w = apiRequest(s, "GET", "/v1/statuses/"+op.Signature, "")
+	var response struct {
+		Status *data.OperationStatus `json:"status"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil || response.Status.State != data.StatusQueued {
+		t.Fatalf("expected a queued status but got %s", w.Body)
+	}
+}
+
+func TestAPISimulate(t *testing.T) {
+	config, kps := NewUnitTestNetwork()
+	s := NewServer(kps[0], config, nil)
+	go s.processMessagesForever()
+	defer s.Stop()
+
+	kp := util.NewKeyPairFromSecretPhrase("client")
+	alice := kp.PublicKey().String()
+	bob := util.NewKeyPairFromSecretPhrase("bob").PublicKey().String()
+	s.setBalance(alice, 100)
+	send := func(sequence uint32, amount uint64) string {
+		op := data.NewSignedOperation(&data.SendOperation{
+			Signer:   alice,
+			Sequence: sequence,
+			To:       bob,
+			Amount:   amount,
+			Fee:      1,
+		}, kp)
+		return string(util.CanonicalJSONEncode(op))
+	}
+	body := "[" + send(1, 10) + "," + send(2, 200) + "," + send(2, 20) + "]"
+
+	for i := 0; i < 2; i++ {
+		// Simulating twice gives the same results, since nothing really changes
+		w := apiRequest(s, "POST", "/v1/simulate", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200 but got %d: %s", w.Code, w.Body)
+		}
+		response := &data.SimulationMessage{}
+		err := json.Unmarshal(w.Body.Bytes(), response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := response.Results
+		if len(r) != 3 {
+			t.Fatalf("expected 3 results but got %s", w.Body)
+		}
+		if r[0].Error != "" || r[0].Fee != 1 || r[0].Accounts[alice].Balance != 89 ||
+			r[0].Accounts[bob].Balance != 10 {
+			t.Fatalf("unexpected result: %+v", r[0])
+		}
+		if r[1].Error == "" || r[1].Accounts != nil {
+			t.Fatalf("expected an error but got %+v", r[1])
+		}
+		if r[2].Error != "" || r[2].Accounts[alice].Balance != 68 {
+			t.Fatalf("unexpected result: %+v", r[2])
+		}
+	}
+}
+
+func TestAPIPending(t *testing.T) {
+	config, kps := NewUnitTestNetwork()
+	s := NewServer(kps[0], config, nil)
+	go s.processMessagesForever()
+	defer s.Stop()
+
+	kp := util.NewKeyPairFromSecretPhrase("client")
+	s.setBalance(kp.PublicKey().String(), 100)
+	op := data.NewSignedOperation(&data.SendOperation{
+		Signer:   kp.PublicKey().String(),
+		Sequence: 1,
+		To:       util.NewKeyPairFromSecretPhrase("bob").PublicKey().String(),
+		Amount:   10,
+		Fee:      3,
+	}, kp)
+	apiRequest(s, "POST", "/v1/operations", string(util.CanonicalJSONEncode(op)))
+
+	w := apiRequest(s, "GET", "/v1/pending?signer="+kp.PublicKey().String(), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 but got %d: %s", w.Code, w.Body)
+	}
+	var response struct {
+		Pending []*data.SignedOperation `json:"pending"`
+		Stats   *data.QueueStats        `json:"stats"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Pending) != 1 || response.Pending[0].Signature != op.Signature {
+		t.Fatalf("expected our operation to be pending but got %s", w.Body)
+	}
+	if response.Stats.Size != 1 || response.Stats.MaxFee != 3 {
+		t.Fatalf("unexpected stats: %+v", response.Stats)
+	}
+
+	w = apiRequest(s, "GET", "/v1/pending?minFee=4", "")
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil || len(response.Pending) != 0 {
+		t.Fatalf("expected nothing pending with a high fee but got %s", w.Body)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lacker/coinkit/util"
@@ -21,22 +22,35 @@ type BasicConnection struct {
 	outbox   chan *util.SignedMessage
 	inbox    chan *util.SignedMessage
 	quit     chan bool
-	closed   bool
 	quitOnce sync.Once
 	start    time.Time
 	stop     time.Time
+
+	// How many messages we have dropped because the outbox was full.
+	// Send runs on many goroutines, so this is only accessed atomically.
+	dropped int64
+
+	// Incoming messages over these limits close the connection
+	limits *util.MessageLimits
 }
 
 // NewBasicConnection creates a new logical connection given a network connection.
 // inbox is the channel to send messages to.
 func NewBasicConnection(conn net.Conn, inbox chan *util.SignedMessage) *BasicConnection {
+	return NewLimitedBasicConnection(conn, inbox, util.DefaultMessageLimits)
+}
+
+// NewLimitedBasicConnection is like NewBasicConnection, but the connection
+// closes when it receives a message that goes over the provided limits.
+func NewLimitedBasicConnection(conn net.Conn, inbox chan *util.SignedMessage,
+	limits *util.MessageLimits) *BasicConnection {
 	c := &BasicConnection{
 		conn:   conn,
 		outbox: make(chan *util.SignedMessage, 100),
 		inbox:  inbox,
 		quit:   make(chan bool),
-		closed: false,
 		start:  time.Now(),
+		limits: limits,
 	}
 	go c.runIncoming()
 	go c.runOutgoing()
@@ -45,14 +59,20 @@ func NewBasicConnection(conn net.Conn, inbox chan *util.SignedMessage) *BasicCon
 
 func (c *BasicConnection) Close() {
 	c.quitOnce.Do(func() {
-		c.closed = true
 		c.stop = time.Now()
 		close(c.quit)
 	})
 }
 
+// IsClosed is threadsafe, since a closed connection is one whose quit
+// channel is closed.
 func (c *BasicConnection) IsClosed() bool {
-	return c.closed
+	select {
+	case <-c.quit:
+		return true
+	default:
+		return false
+	}
 }
 
 func (c *BasicConnection) runIncoming() {
@@ -60,8 +80,8 @@ func (c *BasicConnection) runIncoming() {
 	for {
 		// Wait for 2x the keepalive period
 		c.conn.SetReadDeadline(time.Now().Add(2 * keepalive * time.Second))
-		response, err := util.ReadSignedMessage(reader)
-		if c.closed {
+		response, err := util.ReadLimitedSignedMessage(reader, c.limits)
+		if c.IsClosed() {
 			break
 		}
 		if err != nil {
@@ -72,7 +92,8 @@ func (c *BasicConnection) runIncoming() {
 		if response == nil {
 			panic("connections should not receive nil")
 		}
-		if !response.IsKeepAlive() {
+		// Keepalives with request ids are responses, so they are passed on
+		if !response.IsKeepAlive() || response.RequestID() != "" {
 			c.inbox <- response
 		}
 	}
@@ -111,7 +132,28 @@ func (c *BasicConnection) Send(message *util.SignedMessage) bool {
 	case c.outbox <- message:
 		return true
 	default:
-		util.Logger.Printf("Connection outbox overloaded, dropping message")
+		dropped := int(atomic.AddInt64(&c.dropped, 1))
+		if isPowerOf10(dropped) {
+			util.Logger.Printf("Connection outbox overloaded. %d %s dropped",
+				dropped, util.Pluralize("message", dropped))
+		}
+		return false
+	}
+}
+
+// SendWait is like Send, but when the outbox is full it waits for room
+// instead of dropping the message.
+// It returns false if the connection or quit closes first.
+func (c *BasicConnection) SendWait(message *util.SignedMessage, quit chan bool) bool {
+	if message == nil {
+		panic("should not send nil messages")
+	}
+	select {
+	case c.outbox <- message:
+		return true
+	case <-c.quit:
+		return false
+	case <-quit:
 		return false
 	}
 }
@@ -0,0 +1,38 @@
+package network
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lacker/coinkit/util"
+)
+
+func TestConcurrentSendsCountDrops(t *testing.T) {
+	// Nothing reads the other end of the pipe, so the outbox fills up
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	c := NewBasicConnection(client, make(chan *util.SignedMessage))
+	defer c.Close()
+
+	message := util.KeepAlive()
+	var failed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if !c.Send(message) {
+					atomic.AddInt64(&failed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if failed == 0 || atomic.LoadInt64(&c.dropped) != failed {
+		t.Fatalf("%d sends failed but %d drops were counted", failed, c.dropped)
+	}
+}
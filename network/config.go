@@ -26,6 +26,11 @@ type Config struct {
 
 	// Threshold defines the quorum for the network
 	Threshold int
+
+	// FeeActivationSlot is the first slot that has a base fee.
+	// A network that already has blocks sets it to a slot it has not reached
+	// yet, so that its old blocks still replay. See data.FeeActivationSlot.
+	FeeActivationSlot int
 }
 
 func NewConfigFromSerialized(serialized []byte) *Config {
@@ -15,31 +15,28 @@ type Connection interface {
 }
 
 // SendAnonymousMessage uses a new random key to send a single message.
-func SendAnonymousMessage(c Connection, message *data.QueryMessage) {
+func SendAnonymousMessage(c Connection, message util.Message) {
 	kp := util.NewKeyPair()
 	sm := util.NewSignedMessage(message, kp)
 	c.Send(sm)
 }
 
 // WaitToClear waits for the operation with this account + sequence number to clear.
+// The server responds as soon as it does, so this does not poll.
 func WaitToClear(c Connection, user string, sequence uint32) *data.Account {
 	for {
-		start := time.Now()
-		SendAnonymousMessage(c, &data.QueryMessage{Account: user})
+		SendAnonymousMessage(c, &data.AwaitMessage{Account: user, Sequence: sequence})
 		m := (<-c.Receive()).Message()
-		elapsed := time.Now().Sub(start).Seconds()
-		if elapsed > 1.0 {
-			util.Logger.Printf("warning: server took %.2fs to get account info", elapsed)
-		}
 		dataMessage, ok := m.(*data.DataMessage)
 		if ok {
 			account := dataMessage.Accounts[user]
 			if account != nil && account.Sequence >= sequence {
 				return account
 			}
+		} else {
+			// Don't retry too quickly if the server can't help us
+			time.Sleep(time.Millisecond * 100)
 		}
-
-		time.Sleep(time.Millisecond * 100)
 	}
 }
 
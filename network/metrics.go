@@ -0,0 +1,38 @@
+package network
+
+import (
+	"github.com/lacker/coinkit/util"
+)
+
+var messagesIn = util.NewCounter(
+	"coinkit_messages_in_total",
+	"Messages handled by the node, by message type and sender.",
+	"type", "peer")
+
+var messagesOut = util.NewCounter(
+	"coinkit_messages_out_total",
+	"Messages sent, by message type and recipient.",
+	"type", "peer")
+
+var droppedMessages = util.NewCounter(
+	"coinkit_dropped_messages_total",
+	"Messages dropped because the outbox to a peer was full.",
+	"peer")
+
+var requestsTurnedAway = util.NewCounter(
+	"coinkit_requests_turned_away_total",
+	"Requests turned away because the server was too busy.")
+
+var peersConnected = util.NewGauge(
+	"coinkit_peers_connected", "How many peers we are connected to.")
+
+// peerLabel is the metric label for the sender or recipient of a message.
+// Peers are always labeled by public key, never by address, so that a peer
+// that moves keeps the same series.
+// All clients share a single label so that they cannot create endless metrics.
+func (s *Server) peerLabel(publicKey string) string {
+	if s.isPeer(publicKey) {
+		return publicKey
+	}
+	return "client"
+}
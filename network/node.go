@@ -116,6 +116,17 @@ func (node *Node) Handle(sender string, message util.Message) (util.Message, boo
 		}
 		return em, em != nil
 
+	case *data.QueryMessage:
+		// The only queries the node handles are for pending operations.
+		// Everything else is in the database.
+		if m.Pending == nil {
+			return nil, false
+		}
+		return node.queue.PendingDataMessage(m.Pending), true
+
+	case *data.SimulateMessage:
+		return node.queue.Simulate(m), true
+
 	case *consensus.NominationMessage:
 		answer, ok := node.handleChainMessage(sender, m)
 		return answer, ok
@@ -0,0 +1,50 @@
+package network
+
+import (
+	"time"
+)
+
+// A rateLimiter is a token bucket that refills at a constant rate.
+// rateLimiter is not threadsafe.
+type rateLimiter struct {
+	// How many tokens get added per second
+	rate float64
+
+	// The most tokens the bucket can hold
+	burst float64
+
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// allow takes a token if there is one.
+// If there is no token, it returns false along with how long it will be
+// until the next one is available.
+func (r *rateLimiter) allow(now time.Time) (bool, time.Duration) {
+	elapsed := now.Sub(r.last).Seconds()
+	if elapsed > 0 {
+		r.tokens += elapsed * r.rate
+		if r.tokens > r.burst {
+			r.tokens = r.burst
+		}
+		r.last = now
+	}
+	if r.tokens >= 1 {
+		r.tokens -= 1
+		return true, 0
+	}
+	if r.rate <= 0 {
+		return false, time.Second
+	}
+	wait := (1 - r.tokens) / r.rate
+	return false, time.Duration(wait * float64(time.Second))
+}
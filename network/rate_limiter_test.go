@@ -0,0 +1,33 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	start := time.Now()
+	r := newRateLimiter(10, 3)
+	r.last = start
+	for i := 0; i < 3; i++ {
+		if ok, _ := r.allow(start); !ok {
+			t.Fatalf("the burst should allow message %d", i)
+		}
+	}
+	ok, wait := r.allow(start)
+	if ok {
+		t.Fatalf("the burst should be used up")
+	}
+	if wait <= 0 || wait > 100*time.Millisecond {
+		t.Fatalf("expected to wait at most 100ms but got %s", wait)
+	}
+	if ok, _ := r.allow(start.Add(wait)); !ok {
+		t.Fatalf("a token should be available after waiting")
+	}
+	if ok, _ := r.allow(start.Add(time.Hour)); !ok {
+		t.Fatalf("a token should be available after a long time")
+	}
+	if r.tokens > r.burst {
+		t.Fatalf("the bucket should not hold more than the burst")
+	}
+}
@@ -3,6 +3,7 @@ package network
 import (
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lacker/coinkit/util"
@@ -27,17 +28,35 @@ func isPowerOf10(n int) bool {
 // closed.
 // Some messages might get dropped during a reconnect.
 type RedialConnection struct {
-	conn             *BasicConnection
-	address          *Address
-	inbox            chan *util.SignedMessage
-	outbox           chan *util.SignedMessage
-	quit             chan bool
-	closed           bool
-	quitOnce         sync.Once
-	consecutiveDrops int
+	address *Address
+
+	// The public key of the server on the other end, which labels its
+	// metrics. It is "unknown" when we were only given an address.
+	peer string
+
+	inbox    chan *util.SignedMessage
+	outbox   chan *util.SignedMessage
+	quit     chan bool
+	quitOnce sync.Once
+
+	// mutex protects conn and closed, since Close can be called from any
+	// thread. Only the runOutgoing thread changes conn.
+	mutex  sync.Mutex
+	conn   *BasicConnection
+	closed bool
+
+	// Only accessed atomically, since Send can be called concurrently
+	consecutiveDrops int64
 }
 
 func NewRedialConnection(address *Address,
+	inbox chan *util.SignedMessage) *RedialConnection {
+	return NewPeerConnection("unknown", address, inbox)
+}
+
+// NewPeerConnection is like NewRedialConnection, for a server whose public
+// key we know.
+func NewPeerConnection(publicKey string, address *Address,
 	inbox chan *util.SignedMessage) *RedialConnection {
 	if address == nil {
 		panic("address is nil")
@@ -47,6 +66,7 @@ func NewRedialConnection(address *Address,
 	}
 	c := &RedialConnection{
 		address: address,
+		peer:    publicKey,
 		outbox:  make(chan *util.SignedMessage, 100),
 		inbox:   inbox,
 		quit:    make(chan bool),
@@ -58,30 +78,42 @@ func NewRedialConnection(address *Address,
 
 func (c *RedialConnection) Close() {
 	c.quitOnce.Do(func() {
+		c.mutex.Lock()
 		c.closed = true
-		if c.conn != nil {
-			c.conn.Close()
+		conn := c.conn
+		c.mutex.Unlock()
+		if conn != nil {
+			conn.Close()
 		}
 		close(c.quit)
 	})
 }
 
 func (c *RedialConnection) IsClosed() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	return c.closed
 }
 
+func (c *RedialConnection) getConn() *BasicConnection {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.conn
+}
+
 func (c *RedialConnection) IsConnected() bool {
-	return c.conn != nil && !c.conn.IsClosed()
+	conn := c.getConn()
+	return conn != nil && !conn.IsClosed()
 }
 
 // connect() is not threadsafe and should only be called from the
 // runOutgoing thread
 func (c *RedialConnection) connect() {
-	if c.closed {
+	if c.IsClosed() {
 		// We don't really want to connect
 		return
 	}
-	if c.conn != nil && !c.conn.IsClosed() {
+	if c.IsConnected() {
 		// We already have a connection
 		return
 	}
@@ -89,6 +121,13 @@ func (c *RedialConnection) connect() {
 	for {
 		conn, err := net.Dial("tcp", c.address.String())
 		if err == nil {
+			c.mutex.Lock()
+			defer c.mutex.Unlock()
+			if c.closed {
+				// Close was called while we were dialing
+				conn.Close()
+				return
+			}
 			c.conn = NewBasicConnection(conn, c.inbox)
 			return
 		}
@@ -113,18 +152,24 @@ func (c *RedialConnection) runOutgoing() {
 			// Needed to avoid a race condition where we are
 			// simultaneously closing and opening a new one, and the
 			// new one doesn't get closed
-			if c.conn != nil {
-				c.conn.Close()
+			if conn := c.getConn(); conn != nil {
+				conn.Close()
 			}
 			return
 		case message = <-c.outbox:
 		}
 
 		c.connect()
-		if c.closed {
+		if c.IsClosed() {
 			return
 		}
-		c.conn.Send(message)
+		// Waiting here fills up our own outbox, so a slow connection makes
+		// Send report drops rather than losing messages silently
+		if !c.getConn().SendWait(message, c.quit) && !c.IsClosed() {
+			droppedMessages.Inc(c.peer)
+			util.Logger.Printf("RedialConnection to %s dropped a message while reconnecting",
+				c.address)
+		}
 	}
 }
 
@@ -132,16 +177,17 @@ func (c *RedialConnection) runOutgoing() {
 func (c *RedialConnection) Send(message *util.SignedMessage) bool {
 	select {
 	case c.outbox <- message:
-		c.consecutiveDrops = 0
+		atomic.StoreInt64(&c.consecutiveDrops, 0)
 		return true
 	default:
-		c.consecutiveDrops += 1
-		if isPowerOf10(c.consecutiveDrops) {
+		droppedMessages.Inc(c.peer)
+		drops := int(atomic.AddInt64(&c.consecutiveDrops, 1))
+		if isPowerOf10(drops) {
 			util.Logger.Printf(
 				"RedialConnection outbox to %s overloaded. %d %s dropped",
 				c.address,
-				c.consecutiveDrops,
-				util.Pluralize("message", c.consecutiveDrops))
+				drops,
+				util.Pluralize("message", drops))
 
 		}
 		return false
@@ -7,6 +7,8 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
@@ -17,17 +19,51 @@ import (
 
 var DatabasesInUse *util.SafeSet = util.NewSafeSet()
 
+// RequestQueueSize is how many requests can wait for the processing goroutine.
+// When the queue is full, new requests are turned away with a busy error.
+const RequestQueueSize = 100
+
+// RequestTimeout is how long a request waits for the processing goroutine
+// before we give up on it and tell the sender to retry.
+const RequestTimeout = time.Second
+
+// BusyRetryAfter is how long we tell senders to wait when our queues are full.
+const BusyRetryAfter = 500 * time.Millisecond
+
+// DefaultAwaitTimeout is how long we hold on to an AwaitMessage that does
+// not specify a timeout.
+const DefaultAwaitTimeout = 5 * time.Second
+
+// MaxAwaitTimeout is the longest we will hold on to an AwaitMessage.
+const MaxAwaitTimeout = time.Minute
+
+// MaxAwaits is how many AwaitMessages we hold on to at once, across all
+// connections. Each one ties up a goroutine until it is answered.
+const MaxAwaits = 1000
+
+// MaxConcurrentRequests is how many messages with request ids we handle at
+// once for a single connection.
+const MaxConcurrentRequests = 16
+
 type Server struct {
 	port    int
 	keyPair *util.KeyPair
 	peers   []*RedialConnection
 
+	// The key we sign operations submitted over the JSON API with, before
+	// passing them along to the node
+	apiKeyPair *util.KeyPair
+
 	// The node is capable of handling some sorts of incoming messages
 	// serially.
 	// Generally this is the messages that are trying to do a write to
 	// the blockchain.
 	node *Node
 
+	// The node's record of what happened to operations. Unlike the node,
+	// it is threadsafe.
+	statuses *data.StatusTracker
+
 	// The database is capable of handling some sorts of incoming
 	// messages in parallel.
 	// Generally this is the messages that are trying to read some
@@ -48,14 +84,24 @@ type Server struct {
 	// The last message we broadcasted
 	lastBroadcasted *util.SignedMessage
 
-	// requests contains messages that are going to be handled
+	// requests contains messages from clients that are going to be handled
 	// serially by the node, and *do* require a response.
 	requests chan *Request
 
+	// peerRequests is like requests, but for messages from the other nodes
+	// in our network. They take priority over client requests.
+	peerRequests chan *Request
+
+	// The public keys of the servers in our network
+	peerKeys map[string]bool
+
 	listener net.Listener
 
-	// We close the currentBlock channel whenever the current block is complete
+	// We close the currentBlock channel whenever the current block is complete.
+	// Only the processing goroutine replaces it, and it holds blockLock
+	// while it does.
 	currentBlock chan bool
+	blockLock    sync.Mutex
 
 	// We set shutdown to true and close the quit channel
 	// when the server is shutting down
@@ -65,10 +111,40 @@ type Server struct {
 	// A counter of how many messages we have broadcasted
 	broadcasted int
 
+	// A counter of how many requests we turned away for being busy.
+	// Only access it atomically.
+	rejected int64
+
+	// How many AwaitMessages we are holding on to right now.
+	// Only access it atomically.
+	awaiting int64
+
+	// How many websocket connections we are pushing events to right now.
+	// Only access it atomically.
+	subscribers int64
+
 	start time.Time
 
 	// How often we send out a rebroadcast, resending our redundant data
 	RebroadcastInterval time.Duration
+
+	// How many messages per second a single client connection may send,
+	// and how many it may send in a burst.
+	// Messages from our peers are not limited.
+	ClientRateLimit float64
+	ClientBurst     int
+
+	// Limits on the size and complexity of incoming messages.
+	// Connections that send messages over the limits are closed.
+	Limits *util.MessageLimits
+
+	// How many AwaitMessages we hold on to at once. Past that, awaits are
+	// turned away with a busy error.
+	MaxAwaits int
+
+	// How many websocket subscribers we serve at once. Past that, new
+	// connections are turned away with a busy error.
+	MaxSubscribers int
 }
 
 func NewServer(keyPair *util.KeyPair, config *Config, db *data.Database) *Server {
@@ -83,8 +159,14 @@ func NewServer(keyPair *util.KeyPair, config *Config, db *data.Database) *Server
 
 	peers := []*RedialConnection{}
 	inbox := make(chan *util.SignedMessage)
-	for _, address := range config.PeerAddresses(keyPair) {
-		peers = append(peers, NewRedialConnection(address, inbox))
+	for key, address := range config.Servers {
+		if key != keyPair.PublicKey().String() {
+			peers = append(peers, NewPeerConnection(key, address, inbox))
+		}
+	}
+	peerKeys := make(map[string]bool)
+	for key, _ := range config.Servers {
+		peerKeys[key] = true
 	}
 	qs := config.QuorumSlice()
 	node := NewNode(keyPair.PublicKey(), qs, db)
@@ -96,11 +178,15 @@ func NewServer(keyPair *util.KeyPair, config *Config, db *data.Database) *Server
 	return &Server{
 		port:                config.GetPort(keyPair.PublicKey().String(), 9000),
 		keyPair:             keyPair,
+		apiKeyPair:          util.NewKeyPair(),
 		peers:               peers,
 		node:                node,
+		statuses:            node.queue.Statuses,
 		outgoing:            make(chan []*util.SignedMessage, 10),
 		inbox:               inbox,
-		requests:            make(chan *Request),
+		requests:            make(chan *Request, RequestQueueSize),
+		peerRequests:        make(chan *Request, RequestQueueSize),
+		peerKeys:            peerKeys,
 		listener:            nil,
 		shutdown:            false,
 		quit:                make(chan bool),
@@ -108,6 +194,11 @@ func NewServer(keyPair *util.KeyPair, config *Config, db *data.Database) *Server
 		broadcasted:         0,
 		db:                  db,
 		RebroadcastInterval: time.Second,
+		ClientRateLimit:     100,
+		ClientBurst:         200,
+		Limits:              util.DefaultMessageLimits,
+		MaxAwaits:           MaxAwaits,
+		MaxSubscribers:      MaxSubscribers,
 	}
 }
 
@@ -125,6 +216,11 @@ func (s *Server) assertDone() {
 	s.db.AssertDone()
 }
 
+// isPeer returns whether this public key belongs to a server in our network.
+func (s *Server) isPeer(publicKey string) bool {
+	return s.peerKeys[publicKey]
+}
+
 func (s *Server) numPeersConnected() int {
 	answer := 0
 	for _, peer := range s.peers {
@@ -139,7 +235,13 @@ func (s *Server) numPeersConnected() int {
 // This is likely to include many messages, all separated by endlines.
 func (s *Server) handleConnection(connection net.Conn) {
 	defer connection.Close()
-	conn := NewBasicConnection(connection, make(chan *util.SignedMessage))
+	conn := NewLimitedBasicConnection(
+		connection, make(chan *util.SignedMessage), s.Limits)
+	limiter := newRateLimiter(s.ClientRateLimit, s.ClientBurst)
+
+	// Messages with request ids are handled concurrently, since the sender
+	// can match up the responses. This limits how many run at once.
+	running := make(chan bool, MaxConcurrentRequests)
 
 	for {
 		var sm *util.SignedMessage
@@ -156,14 +258,73 @@ func (s *Server) handleConnection(connection net.Conn) {
 
 		s.lastReceived = sm
 
-		m, ok := s.handleMessage(sm)
-		if !ok {
+		if !s.isPeer(sm.Signer()) {
+			allowed, wait := limiter.allow(time.Now())
+			if !allowed {
+				s.turnAway()
+				conn.Send(s.busyf(wait, "rate limit exceeded").WithRequestID(sm.RequestID()))
+				continue
+			}
+		}
+
+		if sm.RequestID() == "" {
+			if !s.respond(conn, sm) {
+				return
+			}
+			continue
+		}
+
+		select {
+		case running <- true:
+		case <-s.quit:
+			conn.Close()
 			return
 		}
-		if m != nil {
-			conn.Send(m)
+		go func(sm *util.SignedMessage) {
+			defer func() { <-running }()
+			if !s.respond(conn, sm) {
+				conn.Close()
+			}
+		}(sm)
+	}
+}
+
+// respond handles a message from a connection and sends back the response,
+// with the same request id as the message.
+// It returns false if the connection should be closed.
+func (s *Server) respond(conn *BasicConnection, sm *util.SignedMessage) bool {
+	m, ok := s.handleMessage(sm)
+	if !ok {
+		return false
+	}
+	if m == nil && !s.isPeer(sm.Signer()) {
+		// Like over http, we tell clients when there is no response, so
+		// that they don't have to wait to find out.
+		m = util.KeepAlive()
+	}
+	if m == nil {
+		return true
+	}
+	if !conn.Send(m.WithRequestID(sm.RequestID())) {
+		// The other side is not reading its responses. Rather than buffer
+		// without limit, we give up on this connection.
+		s.Logf("dropping a connection that is not reading its responses")
+		return false
+	}
+	return true
+}
+
+// getStatus returns what we know about an operation.
+// Statuses are only kept in memory, so when the tracker has never heard of an
+// operation, like after a restart, we check whether a recent block has it.
+func (s *Server) getStatus(signature string) *data.OperationStatus {
+	status := s.statuses.Get(signature)
+	if status.State == data.StatusUnknown && s.db != nil {
+		if finalized := s.db.FinalizedStatus(signature); finalized != nil {
+			return finalized
 		}
 	}
+	return status
 }
 
 // handleMessage may be called from multiple threads and is used to
@@ -175,9 +336,23 @@ func (s *Server) handleConnection(connection net.Conn) {
 // When handling is complete, it returns (response, true).
 // If handling cannot be completed, like if the server shuts down, it
 // returns (nil, false).
+// If the server is too busy to handle the message, the response is an error
+// message that tells the sender when to retry.
 func (s *Server) handleMessage(sm *util.SignedMessage) (*util.SignedMessage, bool) {
-	// QueryMessages can be handled by the database
+	// QueryMessages can be handled by the database, except for queries about
+	// pending operations, which the node must handle
 	im, ok := sm.Message().(*data.QueryMessage)
+	if ok && im.Pending != nil {
+		ok = false
+	}
+	if ok && im.Status != "" {
+		dm := &data.DataMessage{
+			Statuses: map[string]*data.OperationStatus{
+				im.Status: s.getStatus(im.Status),
+			},
+		}
+		return util.NewSignedMessage(dm, s.keyPair), true
+	}
 	if ok {
 		if s.db == nil {
 			util.Logger.Fatal("you must attach a database to handle QueryMessages")
@@ -192,50 +367,128 @@ func (s *Server) handleMessage(sm *util.SignedMessage) (*util.SignedMessage, boo
 		return util.NewSignedMessage(dm, s.keyPair), true
 	}
 
-	response := make(chan *util.SignedMessage)
+	am, ok := sm.Message().(*data.AwaitMessage)
+	if ok {
+		return s.handleAwaitMessage(am)
+	}
+
+	om, ok := sm.Message().(*data.OperationMessage)
+	if ok {
+		for _, op := range om.Operations {
+			if op != nil {
+				s.statuses.Received(op.Signature)
+			}
+		}
+	}
+
+	// The response channel is buffered so that the processing goroutine never
+	// blocks on a request we have given up on.
+	response := make(chan *util.SignedMessage, 1)
 	request := &Request{
 		Message:  sm,
 		Response: response,
+		Timeout:  RequestTimeout,
+	}
+	queue := s.requests
+	if s.isPeer(sm.Signer()) {
+		queue = s.peerRequests
 	}
 
 	// Send our request to the processing goroutine, wait for the response,
-	// and return it down the connection
-	s.requests <- request
-	timer := time.NewTimer(time.Second)
+	// and return it down the connection.
+	// If the queue is full we turn the request away rather than wait.
+	select {
+	case queue <- request:
+	default:
+		s.turnAway()
+		return s.busyf(BusyRetryAfter, "the server is overloaded"), true
+	}
+	timer := time.NewTimer(request.Timeout)
+	defer timer.Stop()
 	select {
 	case m := <-response:
 		return m, true
 	case <-s.quit:
 		return nil, false
 	case <-timer.C:
-		util.Logger.Fatalf("the processing goroutine got overloaded")
-		return nil, false
+		s.turnAway()
+		return s.busyf(BusyRetryAfter, "timed out waiting for the server"), true
 	}
 }
 
-// retryHandleMessage is like handleMessage, but it expects a non-nil response.
-// If the response is nil, it waits for another block to be finalized and tries again
-// when it is.
-// TODO: this is unused, but I theorize we will want something like this for efficiently
-// awaiting the next block, so let's remove or alter this when we want that.
-func (s *Server) retryHandleMessage(sm *util.SignedMessage) (*util.SignedMessage, bool) {
+// handleAwaitMessage checks the database for what an AwaitMessage is waiting
+// for, and checks again every time a block is finalized, until the wait is
+// over or the timeout expires.
+// It returns (nil, false) if the server shuts down.
+// If we are already holding on to too many awaits, it tells the sender to
+// retry later.
+func (s *Server) handleAwaitMessage(m *data.AwaitMessage) (*util.SignedMessage, bool) {
+	defer atomic.AddInt64(&s.awaiting, -1)
+	if atomic.AddInt64(&s.awaiting, 1) > int64(s.MaxAwaits) {
+		s.turnAway()
+		return s.busyf(BusyRetryAfter, "too many outstanding awaits"), true
+	}
+	if s.db == nil {
+		return s.errorf("this server cannot handle AwaitMessages without a database"), true
+	}
+	if m.Signature == "" && m.Account == "" {
+		return s.errorf("an AwaitMessage needs a signature or an account"), true
+	}
+	timeout := DefaultAwaitTimeout
+	if m.Timeout > 0 {
+		timeout = time.Duration(m.Timeout) * time.Millisecond
+	}
+	if timeout > MaxAwaitTimeout {
+		timeout = MaxAwaitTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
 	for {
-		m, ok := s.handleMessage(sm)
-		if !ok {
-			return nil, false
+		// We get the signal before checking, so that we cannot miss a block
+		// that gets finalized while we check.
+		signal := s.blockSignal()
+		dm, done, err := s.db.AwaitDataMessage(m)
+		if m.Signature != "" {
+			// The operation may have left the queue without using up its
+			// sequence number, so the status tracker has to be checked too
+			status := s.getStatus(m.Signature)
+			if err != nil {
+				status = &data.OperationStatus{
+					Signature: m.Signature,
+					State:     data.StatusInvalidated,
+					Error:     err.Error(),
+				}
+			}
+			if status.IsRejected() && dm.Operations[m.Signature] == nil {
+				done = true
+			}
+			dm.Statuses = map[string]*data.OperationStatus{m.Signature: status}
+		} else if err != nil {
+			return s.errorf("%s", err), true
 		}
-		if m != nil {
-			return m, true
+		if done {
+			return util.NewSignedMessage(dm, s.keyPair), true
 		}
 		select {
-		case <-s.currentBlock:
-			// There's another block, so let the loop retry
+		case <-signal:
+			// There's another block, so check again
+		case <-timer.C:
+			return util.NewSignedMessage(dm, s.keyPair), true
 		case <-s.quit:
 			return nil, false
 		}
 	}
 }
 
+// blockSignal returns a channel that is closed when the current block is complete.
+// It is safe to call from any goroutine.
+func (s *Server) blockSignal() chan bool {
+	s.blockLock.Lock()
+	defer s.blockLock.Unlock()
+	return s.currentBlock
+}
+
 // Flushes the outgoing queue and returns the last value if there is any.
 // Returns [], false if there is none
 // Does not wait
@@ -273,24 +526,51 @@ func (s *Server) unsafeUpdateOutgoing() {
 // unsafeProcessMessage handles a message by interacting with the node directly.
 // It should be only be called from the message-processing thread.
 func (s *Server) unsafeProcessMessage(m *util.SignedMessage) *util.SignedMessage {
+	messagesIn.Inc(m.Message().MessageType(), s.peerLabel(m.Signer()))
 	prevSlot := s.node.Slot()
 	message, hasResponse := s.node.Handle(m.Signer(), m.Message())
 	postSlot := s.node.Slot()
 	s.unsafeUpdateOutgoing()
 
 	if postSlot != prevSlot {
+		s.blockLock.Lock()
 		close(s.currentBlock)
 		s.currentBlock = make(chan bool)
+		s.blockLock.Unlock()
 	}
 
 	// Return the appropriate message
 	if !hasResponse {
 		return nil
 	}
+	messagesOut.Inc(message.MessageType(), s.peerLabel(m.Signer()))
 	sm := util.NewSignedMessage(message, s.keyPair)
 	return sm
 }
 
+// unsafeProcessRequest handles a request and sends back its response.
+// It should only be called from the message-processing thread.
+func (s *Server) unsafeProcessRequest(request *Request) {
+	if request.Message == nil {
+		s.Logf("nil message in request queue")
+		return
+	}
+	response := s.unsafeProcessMessage(request.Message)
+	if request.Response != nil {
+		request.Response <- response
+	}
+}
+
+// unsafeProcessInbox handles a message from the inbox.
+// It should only be called from the message-processing thread.
+func (s *Server) unsafeProcessInbox(message *util.SignedMessage) {
+	if message == nil {
+		s.Logf("nil message in inbox queue")
+		return
+	}
+	s.unsafeProcessMessage(message)
+}
+
 // processMessagesForever should be run in its own goroutine. This is the only
 // thread that is allowed to access the node, because node is not threadsafe.
 // The 'unsafe' methods should only be called from within here.
@@ -299,31 +579,43 @@ func (s *Server) processMessagesForever() {
 	s.unsafeUpdateOutgoing()
 
 	for {
+		// Traffic from our peers goes first, so that a burst of client
+		// requests cannot stall consensus.
+		select {
+		case request := <-s.peerRequests:
+			if s.shutdown {
+				return
+			}
+			s.unsafeProcessRequest(request)
+			continue
+		case message := <-s.inbox:
+			if s.shutdown {
+				return
+			}
+			s.unsafeProcessInbox(message)
+			continue
+		default:
+		}
 
 		select {
 
-		case request := <-s.requests:
+		case request := <-s.peerRequests:
 			if s.shutdown {
 				return
 			}
-			if request.Message != nil {
-				response := s.unsafeProcessMessage(request.Message)
-				if request.Response != nil {
-					request.Response <- response
-				}
-			} else {
-				s.Logf("nil message in request queue")
-			}
+			s.unsafeProcessRequest(request)
 
 		case message := <-s.inbox:
 			if s.shutdown {
 				return
 			}
-			if message != nil {
-				s.unsafeProcessMessage(message)
-			} else {
-				s.Logf("nil message in inbox queue")
+			s.unsafeProcessInbox(message)
+
+		case request := <-s.requests:
+			if s.shutdown {
+				return
 			}
+			s.unsafeProcessRequest(request)
 
 		case <-s.quit:
 			return
@@ -366,7 +658,9 @@ func (s *Server) acquirePort() {
 func (s *Server) broadcast(messages []*util.SignedMessage) {
 	for _, message := range messages {
 		for _, peer := range s.peers {
-			peer.Send(message)
+			if peer.Send(message) {
+				messagesOut.Inc(message.Message().MessageType(), peer.peer)
+			}
 		}
 		s.lastBroadcasted = message
 		s.broadcasted += 1
@@ -477,6 +771,10 @@ func (s *Server) ServeHttpInBackground(port int) {
 		fmt.Fprintf(w, "%.1fs uptime\n", s.Uptime())
 		fmt.Fprintf(w, "%d messages broadcasted\n", s.broadcasted)
 		fmt.Fprintf(w, "%d peers connected\n", s.numPeersConnected())
+		fmt.Fprintf(w, "%d requests turned away\n", atomic.LoadInt64(&s.rejected))
+		for kind, count := range util.LimitRejections.Items() {
+			fmt.Fprintf(w, "%d messages over the %s limit\n", count, kind)
+		}
 		fmt.Fprintf(w, "current slot: %d\n", s.node.Slot())
 		fmt.Fprintf(w, "DB_USER: %s\n", os.Getenv("DB_USER"))
 		fmt.Fprintf(w, "public key: %s\n", s.keyPair.PublicKey())
@@ -514,6 +812,19 @@ func (s *Server) ServeHttpInBackground(port int) {
 	http.HandleFunc("/messages/", messageHandler)
 	http.HandleFunc("/messages", messageHandler)
 
+	// /metrics exports metrics in the Prometheus text format
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		peersConnected.Set(float64(s.numPeersConnected()))
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		util.WriteMetrics(w)
+	})
+
+	// /v1/ is a JSON API for clients that do not speak the message protocol
+	http.HandleFunc("/v1/", s.handleAPI)
+
+	// /v1/subscribe is a websocket that pushes events after each block
+	http.HandleFunc("/v1/subscribe", s.handleSubscribe)
+
 	srv := &http.Server{
 		Addr: fmt.Sprintf(":%d", port),
 	}
@@ -525,10 +836,11 @@ func (s *Server) ServeHttpInBackground(port int) {
 }
 
 // Handles an http request containing a message, from a client.
-// Returns the message that should be returned.
+// Returns the message that should be returned, with the same request id as
+// the message in the request.
 func (s *Server) handleMessageRequest(r *http.Request) *util.SignedMessage {
 	reader := bufio.NewReader(r.Body)
-	input, err := util.ReadSignedMessage(reader)
+	input, err := util.ReadLimitedSignedMessage(reader, s.Limits)
 	if err != nil {
 		return s.errorf("error in reading signed message: %s", err)
 	}
@@ -536,11 +848,14 @@ func (s *Server) handleMessageRequest(r *http.Request) *util.SignedMessage {
 	// util.Logger.Printf("handling /messages/ input: %v", input)
 	output, ok := s.handleMessage(input)
 	if !ok {
-		return s.errorf("the server is overloaded or is shutting down")
+		output = s.errorf("the server is overloaded or is shutting down")
 	}
 
 	// util.Logger.Printf("got response message: %v", output)
-	return output
+	if output == nil {
+		output = util.KeepAlive()
+	}
+	return output.WithRequestID(input.RequestID())
 }
 
 // Creates a signed error message
@@ -551,6 +866,26 @@ func (s *Server) errorf(format string, a ...interface{}) *util.SignedMessage {
 	return util.NewSignedMessage(msg, s.keyPair)
 }
 
+// turnAway counts a request that we were too busy to handle.
+func (s *Server) turnAway() {
+	atomic.AddInt64(&s.rejected, 1)
+	requestsTurnedAway.Inc()
+}
+
+// Creates a signed error message telling the sender we are too busy, and
+// when to retry.
+func (s *Server) busyf(retryAfter time.Duration, format string, a ...interface{}) *util.SignedMessage {
+	millis := int(retryAfter / time.Millisecond)
+	if millis < 1 {
+		millis = 1
+	}
+	msg := &util.ErrorMessage{
+		Error:      fmt.Sprintf(format, a...),
+		RetryAfter: millis,
+	}
+	return util.NewSignedMessage(msg, s.keyPair)
+}
+
 // Uptime returns uptime in seconds
 func (s *Server) Uptime() float64 {
 	return time.Now().Sub(s.start).Seconds()
@@ -560,6 +895,10 @@ func (s *Server) Stats() {
 	s.Logf("server stats:")
 	s.Logf("%.1fs uptime", s.Uptime())
 	s.Logf("%d messages broadcasted", s.broadcasted)
+	s.Logf("%d requests turned away", atomic.LoadInt64(&s.rejected))
+	for kind, count := range util.LimitRejections.Items() {
+		s.Logf("%d messages over the %s limit", count, kind)
+	}
 	s.node.Stats()
 }
 
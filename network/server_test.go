@@ -251,3 +251,99 @@ func TestDataOperations(t *testing.T) {
 
 	stopServers(servers)
 }
+
+func TestServerTurnsAwayRequestsWhenBusy(t *testing.T) {
+	config, kps := NewUnitTestNetwork()
+	s := NewServer(kps[0], config, nil)
+
+	// Without a processing goroutine running, the request queue fills up
+	for i := 0; i < RequestQueueSize; i++ {
+		s.requests <- &Request{}
+	}
+
+	kp := util.NewKeyPairFromSecretPhrase("client")
+	sm := util.NewSignedMessage(&data.OperationMessage{}, kp)
+	response, ok := s.handleMessage(sm)
+	if !ok {
+		t.Fatalf("a busy server should still respond")
+	}
+	em, ok := response.Message().(*util.ErrorMessage)
+	if !ok {
+		t.Fatalf("expected error message but got %+v", response.Message())
+	}
+	if !em.IsBusy() {
+		t.Fatalf("expected a busy error but got %+v", em)
+	}
+}
+
+func TestServerTurnsAwayAwaitsPastTheLimit(t *testing.T) {
+	config, kps := NewUnitTestNetwork()
+	s := NewServer(kps[0], config, nil)
+	s.MaxAwaits = 1
+
+	kp := util.NewKeyPairFromSecretPhrase("client")
+	sm := util.NewSignedMessage(&data.AwaitMessage{Account: "bob"}, kp)
+
+	// Under the limit, the await gets as far as noticing there is no database
+	response, _ := s.handleMessage(sm)
+	em := response.Message().(*util.ErrorMessage)
+	if em.IsBusy() {
+		t.Fatalf("an await under the limit should not be turned away")
+	}
+
+	// Pretend another await is still waiting
+	s.awaiting = 1
+	response, _ = s.handleMessage(sm)
+	em = response.Message().(*util.ErrorMessage)
+	if !em.IsBusy() {
+		t.Fatalf("expected a busy error but got %+v", em)
+	}
+	if s.awaiting != 1 {
+		t.Fatalf("a turned away await should not stay counted, got %d", s.awaiting)
+	}
+}
+
+func TestServerEchoesRequestIDs(t *testing.T) {
+	config, kps := NewUnitTestNetwork()
+	s := NewServer(kps[0], config, nil)
+	s.ServeInBackground()
+	defer s.Stop()
+
+	kp := util.NewKeyPairFromSecretPhrase("client")
+	s.setBalance(kp.PublicKey().String(), 100)
+	op := data.NewSignedOperation(&data.SendOperation{
+		Signer:   kp.PublicKey().String(),
+		Sequence: 1,
+		To:       util.NewKeyPairFromSecretPhrase("bob").PublicKey().String(),
+		Amount:   10,
+		Fee:      1,
+	}, kp)
+
+	bad := data.NewSignedOperation(&data.SendOperation{
+		Signer:   kp.PublicKey().String(),
+		Sequence: 5,
+		To:       util.NewKeyPairFromSecretPhrase("bob").PublicKey().String(),
+		Amount:   10,
+		Fee:      1,
+	}, kp)
+
+	conn := NewRedialConnection(s.LocalhostAddress(), nil)
+	defer conn.Close()
+	conn.Send(util.NewSignedMessage(data.NewOperationMessage(bad), kp).WithRequestID("bad"))
+	conn.Send(util.NewSignedMessage(data.NewOperationMessage(op), kp).WithRequestID("good"))
+
+	responses := make(map[string]*util.SignedMessage)
+	for len(responses) < 2 {
+		sm := <-conn.Receive()
+		if sm == nil {
+			t.Fatalf("connection closed early")
+		}
+		responses[sm.RequestID()] = sm
+	}
+	if _, ok := responses["bad"].Message().(*util.ErrorMessage); !ok {
+		t.Fatalf("expected an error for the bad request")
+	}
+	if !responses["good"].IsKeepAlive() {
+		t.Fatalf("expected no response for the good request")
+	}
+}
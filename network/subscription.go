@@ -0,0 +1,313 @@
+package network
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/lacker/coinkit/data"
+	"github.com/lacker/coinkit/util"
+)
+
+// MaxDocumentSubscriptions is how many document queries a single websocket
+// connection can subscribe to. Each of them is rerun after every block.
+const MaxDocumentSubscriptions = 10
+
+// MaxSubscriptions is how many accounts and signatures, combined, a single
+// websocket connection can subscribe to.
+const MaxSubscriptions = 1000
+
+// MaxSubscribers is how many websocket connections we serve at once.
+const MaxSubscribers = 1000
+
+// How long we wait for a websocket client to accept an event
+const eventWriteTimeout = 10 * time.Second
+
+// A SubscribeRequest is sent by a websocket client to /v1/subscribe to start
+// receiving events. Subscriptions from multiple requests are combined.
+type SubscribeRequest struct {
+	// When Blocks is true, every finalized block is sent.
+	Blocks bool `json:"blocks"`
+
+	// Accounts lists the public keys of accounts to send changes for.
+	Accounts []string `json:"accounts"`
+
+	// Signatures lists operations to send once they are finalized.
+	Signatures []string `json:"signatures"`
+
+	// Documents lists queries to send new or changed matching documents for.
+	Documents []*data.DocumentQuery `json:"documents"`
+}
+
+// An Event is pushed to websocket clients when something they subscribed to
+// happens.
+type Event struct {
+	// Type is "block", "account", "signature", or "document"
+	Type string `json:"type"`
+
+	// The slot of the block that caused this event
+	Slot int `json:"slot"`
+
+	Block *data.Block `json:"block,omitempty"`
+
+	// For account events, the owner and the new state of the account
+	Owner   string        `json:"owner,omitempty"`
+	Account *data.Account `json:"account,omitempty"`
+
+	// For signature events, the operation that was finalized
+	Operation *data.SignedOperation `json:"operation,omitempty"`
+
+	// For document events, the query the document matched
+	Query    *data.DocumentQuery `json:"query,omitempty"`
+	Document *data.Document      `json:"document,omitempty"`
+}
+
+// Encode returns the JSON that is sent to websocket clients for this event.
+// It is canonical, so that clients can verify the signed operations in it.
+func (e *Event) Encode() []byte {
+	return util.CanonicalJSONEncode(e)
+}
+
+// A subscriber tracks what a single websocket client is subscribed to.
+// It is not threadsafe.
+type subscriber struct {
+	blocks     bool
+	accounts   map[string]bool
+	signatures map[string]bool
+	documents  []*documentSubscription
+}
+
+// A documentSubscription remembers what a document query last returned,
+// so that we only send documents that are new or changed.
+type documentSubscription struct {
+	query *data.DocumentQuery
+
+	// The encoded data of each matching document, keyed by id
+	snapshot map[uint64]string
+}
+
+func newSubscriber() *subscriber {
+	return &subscriber{
+		accounts:   make(map[string]bool),
+		signatures: make(map[string]bool),
+		documents:  []*documentSubscription{},
+	}
+}
+
+// add adds the subscriptions in a request, returning any new document
+// subscriptions so that the caller can take their initial snapshot.
+// Subscriptions past the per-connection limits are ignored.
+func (sub *subscriber) add(req *SubscribeRequest) []*documentSubscription {
+	if req.Blocks {
+		sub.blocks = true
+	}
+	for _, account := range req.Accounts {
+		if sub.accounts[account] || sub.full() {
+			continue
+		}
+		sub.accounts[account] = true
+	}
+	for _, signature := range req.Signatures {
+		if sub.signatures[signature] || sub.full() {
+			continue
+		}
+		sub.signatures[signature] = true
+	}
+	added := []*documentSubscription{}
+	for _, query := range req.Documents {
+		if query == nil || len(sub.documents) >= MaxDocumentSubscriptions {
+			continue
+		}
+		if query.Data == nil {
+			query.Data = data.NewEmptyJSONObject()
+		}
+		ds := &documentSubscription{
+			query:    query,
+			snapshot: make(map[uint64]string),
+		}
+		sub.documents = append(sub.documents, ds)
+		added = append(added, ds)
+	}
+	return added
+}
+
+// full returns whether there is no room for more account or signature
+// subscriptions.
+func (sub *subscriber) full() bool {
+	return len(sub.accounts)+len(sub.signatures) >= MaxSubscriptions
+}
+
+// blockEvents returns the events that a newly finalized block causes.
+func (sub *subscriber) blockEvents(block *data.Block) []*Event {
+	events := []*Event{}
+	if sub.blocks {
+		events = append(events, &Event{Type: "block", Slot: block.Slot, Block: block})
+	}
+	if block.Chunk == nil {
+		return events
+	}
+	for owner, account := range block.Chunk.Accounts {
+		if sub.accounts[owner] {
+			events = append(events, &Event{
+				Type:    "account",
+				Slot:    block.Slot,
+				Owner:   owner,
+				Account: account,
+			})
+		}
+	}
+	for _, op := range block.Chunk.Operations {
+		if sub.signatures[op.Signature] {
+			events = append(events, &Event{
+				Type:      "signature",
+				Slot:      block.Slot,
+				Operation: op,
+			})
+			delete(sub.signatures, op.Signature)
+		}
+	}
+	return events
+}
+
+// update replaces the snapshot with the latest results of the query, and
+// returns events for the documents that are new or changed.
+func (ds *documentSubscription) update(docs []*data.Document, slot int) []*Event {
+	events := []*Event{}
+	snapshot := make(map[uint64]string)
+	for _, doc := range docs {
+		encoded := string(util.ToJSON(doc.Data))
+		snapshot[doc.ID] = encoded
+		if ds.snapshot[doc.ID] != encoded {
+			events = append(events, &Event{
+				Type:     "document",
+				Slot:     slot,
+				Query:    ds.query,
+				Document: doc,
+			})
+		}
+	}
+	ds.snapshot = snapshot
+	return events
+}
+
+var upgrader = websocket.Upgrader{
+	// The API is meant to be used by pages served from anywhere
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// readSubscribeRequests sends requests from the websocket to the channel
+// until the connection fails or done is closed, and then closes the channel.
+func readSubscribeRequests(conn *websocket.Conn, requests chan *SubscribeRequest,
+	done chan bool) {
+	defer close(requests)
+	for {
+		req := &SubscribeRequest{}
+		err := conn.ReadJSON(req)
+		if err != nil {
+			return
+		}
+		select {
+		case requests <- req:
+		case <-done:
+			return
+		}
+	}
+}
+
+// lastFinalizedSlot returns 0 when no blocks have been finalized.
+func (s *Server) lastFinalizedSlot() int {
+	block := s.db.LastBlock()
+	if block == nil {
+		return 0
+	}
+	return block.Slot
+}
+
+// handleSubscribe upgrades to a websocket and pushes events to the client
+// every time a block is finalized.
+// When we already have too many subscribers, it responds with a busy error
+// instead.
+func (s *Server) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	defer atomic.AddInt64(&s.subscribers, -1)
+	if atomic.AddInt64(&s.subscribers, 1) > int64(s.MaxSubscribers) {
+		s.turnAway()
+		millis := int(BusyRetryAfter / time.Millisecond)
+		writeJSON(w, http.StatusServiceUnavailable, &APIError{
+			Error:      "too many subscribers",
+			RetryAfter: millis,
+		})
+		return
+	}
+	if s.db == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, "this server has no database")
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already responded with an error
+		return
+	}
+	defer conn.Close()
+	if s.Limits.MaxLineSize > 0 {
+		conn.SetReadLimit(int64(s.Limits.MaxLineSize))
+	}
+
+	requests := make(chan *SubscribeRequest)
+	done := make(chan bool)
+	defer close(done)
+	go readSubscribeRequests(conn, requests, done)
+
+	sub := newSubscriber()
+	send := func(events []*Event) bool {
+		for _, event := range events {
+			conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+			if conn.WriteMessage(websocket.TextMessage, event.Encode()) != nil {
+				return false
+			}
+		}
+		return true
+	}
+
+	// We get the signal before checking the database, so that we cannot miss
+	// a block that gets finalized in between.
+	signal := s.blockSignal()
+	last := s.lastFinalizedSlot()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+
+		case req, ok := <-requests:
+			if !ok {
+				return
+			}
+			for _, ds := range sub.add(req) {
+				dm := s.db.DocumentDataMessage(ds.query)
+				ds.update(dm.Documents, dm.I)
+			}
+
+		case <-signal:
+			signal = s.blockSignal()
+			events := []*Event{}
+			current := s.lastFinalizedSlot()
+			for slot := last + 1; slot <= current; slot++ {
+				block := s.db.GetBlock(slot)
+				if block == nil {
+					break
+				}
+				events = append(events, sub.blockEvents(block)...)
+			}
+			last = current
+			for _, ds := range sub.documents {
+				dm := s.db.DocumentDataMessage(ds.query)
+				events = append(events, ds.update(dm.Documents, dm.I)...)
+			}
+			if !send(events) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lacker/coinkit/data"
+	"github.com/lacker/coinkit/util"
+)
+
+func TestBlockEvents(t *testing.T) {
+	kp := util.NewKeyPairFromSecretPhrase("alice")
+	alice := kp.PublicKey().String()
+	bob := util.NewKeyPairFromSecretPhrase("bob").PublicKey().String()
+	op := data.NewSignedOperation(&data.SendOperation{
+		Signer:   alice,
+		Sequence: 1,
+		To:       bob,
+		Amount:   10,
+		Fee:      1,
+	}, kp)
+	block := &data.Block{
+		Slot: 3,
+		Chunk: &data.LedgerChunk{
+			Accounts: map[string]*data.Account{
+				alice: &data.Account{Owner: alice, Sequence: 1, Balance: 89},
+				bob:   &data.Account{Owner: bob, Balance: 10},
+			},
+			Operations: []*data.SignedOperation{op},
+		},
+	}
+
+	sub := newSubscriber()
+	if len(sub.blockEvents(block)) != 0 {
+		t.Fatalf("expected no events without subscriptions")
+	}
+
+	sub.add(&SubscribeRequest{
+		Accounts:   []string{bob},
+		Signatures: []string{op.Signature},
+	})
+	events := sub.blockEvents(block)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events but got %d", len(events))
+	}
+	if events[0].Type != "account" || events[0].Account.Balance != 10 {
+		t.Fatalf("bad account event: %+v", events[0])
+	}
+	if events[1].Type != "signature" || events[1].Slot != 3 {
+		t.Fatalf("bad signature event: %+v", events[1])
+	}
+
+	// Clients have to be able to verify the operation they get
+	decoded := &Event{}
+	err := json.Unmarshal(events[1].Encode(), decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Operation == nil || decoded.Operation.Signature != op.Signature {
+		t.Fatalf("the operation did not survive encoding: %+v", decoded)
+	}
+
+	// An operation is only finalized once
+	if len(sub.blockEvents(block)) != 1 {
+		t.Fatalf("expected only the account event the second time")
+	}
+
+	sub.add(&SubscribeRequest{Blocks: true})
+	events = sub.blockEvents(block)
+	if len(events) != 2 || events[0].Block != block {
+		t.Fatalf("expected a block event")
+	}
+}
+
+func TestDocumentEvents(t *testing.T) {
+	sub := newSubscriber()
+	added := sub.add(&SubscribeRequest{
+		Documents: []*data.DocumentQuery{&data.DocumentQuery{}},
+	})
+	if len(added) != 1 {
+		t.Fatalf("expected one document subscription")
+	}
+	ds := added[0]
+
+	doc1 := data.NewDocument(1, map[string]interface{}{"color": "red"})
+	doc2 := data.NewDocument(2, map[string]interface{}{"color": "blue"})
+	if len(ds.update([]*data.Document{doc1}, 1)) != 1 {
+		t.Fatalf("a new document should cause an event")
+	}
+	if len(ds.update([]*data.Document{doc1}, 2)) != 0 {
+		t.Fatalf("an unchanged document should not cause an event")
+	}
+	changed := data.NewDocument(1, map[string]interface{}{"color": "green"})
+	events := ds.update([]*data.Document{changed, doc2}, 3)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events but got %d", len(events))
+	}
+	if events[0].Document != changed || events[0].Slot != 3 {
+		t.Fatalf("bad document event: %+v", events[0])
+	}
+}
+
+func TestSubscriptionLimit(t *testing.T) {
+	sub := newSubscriber()
+	accounts := []string{}
+	for i := 0; i < MaxSubscriptions; i++ {
+		accounts = append(accounts, fmt.Sprintf("account%d", i))
+	}
+	sub.add(&SubscribeRequest{Accounts: accounts})
+	sub.add(&SubscribeRequest{
+		Accounts:   []string{"account0", "onetoomany"},
+		Signatures: []string{"signature"},
+	})
+	if len(sub.accounts) != MaxSubscriptions || len(sub.signatures) != 0 {
+		t.Fatalf("expected subscriptions to stop at %d but got %d accounts and %d signatures",
+			MaxSubscriptions, len(sub.accounts), len(sub.signatures))
+	}
+}
+
+func TestSubscriberLimit(t *testing.T) {
+	config, kps := NewUnitTestNetwork()
+	s := NewServer(kps[0], config, nil)
+	s.MaxSubscribers = 1
+
+	// Pretend another connection is already subscribed
+	s.subscribers = 1
+	w := httptest.NewRecorder()
+	s.handleSubscribe(w, httptest.NewRequest("GET", "/v1/subscribe", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503 but got %d", w.Code)
+	}
+	apiError := &APIError{}
+	err := json.Unmarshal(w.Body.Bytes(), apiError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if apiError.RetryAfter == 0 {
+		t.Fatalf("expected a busy error but got %+v", apiError)
+	}
+	if s.subscribers != 1 {
+		t.Fatalf("a turned away subscriber should not stay counted, got %d", s.subscribers)
+	}
+}
@@ -4,6 +4,10 @@ package util
 // It is just an encapsulation to be shown to a human for debugging.
 type ErrorMessage struct {
 	Error string `json:"error"`
+
+	// When RetryAfter is nonzero, the server was too busy to handle the request.
+	// The sender should wait this many milliseconds before trying again.
+	RetryAfter int `json:"retryAfter,omitempty"`
 }
 
 func (m *ErrorMessage) Slot() int {
@@ -18,6 +22,11 @@ func (m *ErrorMessage) String() string {
 	return m.Error
 }
 
+// IsBusy returns whether this error means the sender should retry later.
+func (m *ErrorMessage) IsBusy() bool {
+	return m.RetryAfter > 0
+}
+
 func init() {
 	RegisterMessageType(&ErrorMessage{})
 }
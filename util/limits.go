@@ -0,0 +1,94 @@
+package util
+
+import (
+	"fmt"
+)
+
+// MessageLimits bound how much work a single incoming message can make us do.
+// A zero value for any limit means that thing is not limited.
+type MessageLimits struct {
+	// The longest line we will read, in bytes, not counting the newline
+	MaxLineSize int
+
+	// The deepest nesting of JSON objects and arrays we will decode
+	MaxJSONDepth int
+
+	// The most operations a single message can contain
+	MaxOperations int
+
+	// The most ledger chunks a single message can contain
+	MaxChunks int
+}
+
+// DefaultMessageLimits are used whenever no other limits are provided.
+var DefaultMessageLimits = &MessageLimits{
+	MaxLineSize:   32 * 1024 * 1024,
+	MaxJSONDepth:  64,
+	MaxOperations: 2000,
+	MaxChunks:     100,
+}
+
+// A LimitError is returned when a message goes over one of the limits.
+type LimitError struct {
+	// Kind is one of "line", "depth", "operations", or "chunks"
+	Kind string
+
+	Limit int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("message exceeds the %s limit of %d", e.Kind, e.Limit)
+}
+
+// LimitRejections counts how many messages we rejected for each kind of limit.
+var LimitRejections = NewSafeCounter()
+
+var limitRejectionsMetric = NewCounter(
+	"coinkit_messages_over_limit_total",
+	"Incoming messages rejected for going over a limit, by kind of limit.",
+	"kind")
+
+// A Message type that holds a variable number of items can implement
+// LimitedMessage, so that it gets checked before it is fully decoded.
+type LimitedMessage interface {
+	// CheckLimits is passed the encoded message, and should return an error
+	// without doing the full decoding work when it is over the limits.
+	CheckLimits(encoded []byte, limits *MessageLimits) error
+}
+
+// CheckJSONDepth returns a LimitError if the JSON nests objects and arrays
+// deeper than maxDepth.
+// It does not check that the JSON is otherwise valid.
+func CheckJSONDepth(bs []byte, maxDepth int) error {
+	if maxDepth <= 0 {
+		return nil
+	}
+	depth := 0
+	inString := false
+	escaped := false
+	for _, b := range bs {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case b == '\\':
+				escaped = true
+			case b == '"':
+				inString = false
+			}
+			continue
+		}
+		switch b {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > maxDepth {
+				return &LimitError{Kind: "depth", Limit: maxDepth}
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return nil
+}
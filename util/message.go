@@ -88,10 +88,20 @@ func EncodeMessage(m Message) string {
 }
 
 func DecodeMessage(encoded string) (Message, error) {
+	return DecodeLimitedMessage(encoded, DefaultMessageLimits)
+}
+
+// DecodeLimitedMessage is like DecodeMessage, but it returns a LimitError
+// instead of decoding messages that go over the provided limits.
+func DecodeLimitedMessage(encoded string, limits *MessageLimits) (Message, error) {
 	bytes := []byte(encoded)
+	err := CheckJSONDepth(bytes, limits.MaxJSONDepth)
+	if err != nil {
+		return nil, err
+	}
 
 	var pdm PartiallyDecodedMessage
-	err := json.Unmarshal(bytes, &pdm)
+	err = json.Unmarshal(bytes, &pdm)
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +118,12 @@ func DecodeMessage(encoded string) (Message, error) {
 		return nil, fmt.Errorf("unregistered message type: %s", pdm.Type)
 	}
 	m := reflect.New(messageType).Interface().(Message)
+	if lm, ok := m.(LimitedMessage); ok {
+		err = lm.CheckLimits(pdm.Message, limits)
+		if err != nil {
+			return nil, err
+		}
+	}
 	err = json.Unmarshal(pdm.Message, &m)
 	if err != nil {
 		return nil, err
@@ -48,3 +48,15 @@ func TestDecodingInvalidMessage(t *testing.T) {
 		t.Fatal("an encoded nil message should fail to decode")
 	}
 }
+
+func TestErrorMessageEncodingUnchanged(t *testing.T) {
+	encoded := EncodeMessage(&ErrorMessage{Error: "oops"})
+	expected := `{"message":{"error":"oops"},"type":"Error"}`
+	if encoded != expected {
+		t.Fatalf("expected %s but got %s", expected, encoded)
+	}
+	m := EncodeThenDecodeMessage(&ErrorMessage{Error: "busy", RetryAfter: 5})
+	if m.(*ErrorMessage).RetryAfter != 5 {
+		t.Fatal("RetryAfter did not survive encoding")
+	}
+}
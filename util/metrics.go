@@ -0,0 +1,288 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// This file implements just enough of the Prometheus text format to export
+// counters, gauges, and histograms.
+// See https://prometheus.io/docs/instrumenting/exposition_formats/
+// Metrics are registered globally when they are created, and are all
+// threadsafe.
+
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+var metricsLock sync.Mutex
+var registeredMetrics = make(map[string]metric)
+
+func registerMetric(m metric) {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	_, ok := registeredMetrics[m.name()]
+	if ok {
+		Logger.Fatalf("metric registered multiple times: %s", m.name())
+	}
+	registeredMetrics[m.name()] = m
+}
+
+// WriteMetrics writes every registered metric in the Prometheus text format.
+func WriteMetrics(w io.Writer) {
+	metricsLock.Lock()
+	names := []string{}
+	for name, _ := range registeredMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metrics := []metric{}
+	for _, name := range names {
+		metrics = append(metrics, registeredMetrics[name])
+	}
+	metricsLock.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// The values of a metric for every combination of labels, keyed by
+// the formatted labels
+type labeledValues struct {
+	labels []string
+	mutex  sync.Mutex
+	keys   []string
+}
+
+func (lv *labeledValues) key(values []string) string {
+	if len(values) != len(lv.labels) {
+		Logger.Fatalf("expected %d label values but got %d", len(lv.labels), len(values))
+	}
+	parts := []string{}
+	for i, label := range lv.labels {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(values[i])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, label, value))
+	}
+	return strings.Join(parts, ",")
+}
+
+// braces wraps formatted labels, plus an optional extra label, in braces.
+func braces(key string, extra string) string {
+	switch {
+	case key == "" && extra == "":
+		return ""
+	case key == "":
+		return "{" + extra + "}"
+	case extra == "":
+		return "{" + key + "}"
+	}
+	return "{" + key + "," + extra + "}"
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprintf("%g", f)
+}
+
+// A Counter is a value that only goes up.
+type Counter struct {
+	metricName string
+	help       string
+	labeledValues
+	values map[string]float64
+}
+
+// NewCounter creates and registers a counter. If labels are provided,
+// the counter is tracked separately for every combination of label values.
+func NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{
+		metricName:    name,
+		help:          help,
+		labeledValues: labeledValues{labels: labels},
+		values:        make(map[string]float64),
+	}
+	registerMetric(c)
+	return c
+}
+
+func (c *Counter) name() string {
+	return c.metricName
+}
+
+// Inc adds one to the counter for these label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a nonnegative amount to the counter for these label values.
+func (c *Counter) Add(amount float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.values[key]; !ok {
+		c.keys = append(c.keys, key)
+	}
+	c.values[key] += amount
+}
+
+// Get returns the current value for these label values.
+func (c *Counter) Get(labelValues ...string) float64 {
+	key := c.key(labelValues)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.values[key]
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.metricName, c.help, c.metricName)
+	for _, key := range c.keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, braces(key, ""), formatFloat(c.values[key]))
+	}
+}
+
+// A Gauge is a value that can go up and down.
+type Gauge struct {
+	metricName string
+	help       string
+	labeledValues
+	values map[string]float64
+}
+
+// NewGauge creates and registers a gauge.
+func NewGauge(name string, help string, labels ...string) *Gauge {
+	g := &Gauge{
+		metricName:    name,
+		help:          help,
+		labeledValues: labeledValues{labels: labels},
+		values:        make(map[string]float64),
+	}
+	registerMetric(g)
+	return g
+}
+
+func (g *Gauge) name() string {
+	return g.metricName
+}
+
+// Set sets the gauge for these label values.
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if _, ok := g.values[key]; !ok {
+		g.keys = append(g.keys, key)
+	}
+	g.values[key] = value
+}
+
+// Get returns the current value for these label values.
+func (g *Gauge) Get(labelValues ...string) float64 {
+	key := g.key(labelValues)
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.values[key]
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.metricName, g.help, g.metricName)
+	for _, key := range g.keys {
+		fmt.Fprintf(w, "%s%s %s\n", g.metricName, braces(key, ""), formatFloat(g.values[key]))
+	}
+}
+
+// DefaultLatencyBuckets are histogram buckets for latencies in seconds.
+var DefaultLatencyBuckets = []float64{
+	0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// A Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	metricName string
+	help       string
+	labeledValues
+
+	// Upper bounds of the buckets, not including +Inf
+	buckets []float64
+
+	counts map[string][]uint64
+	sums   map[string]float64
+	totals map[string]uint64
+}
+
+// NewHistogram creates and registers a histogram with the given bucket
+// upper bounds, which must be sorted.
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		Logger.Fatalf("histogram buckets for %s are not sorted", name)
+	}
+	h := &Histogram{
+		metricName:    name,
+		help:          help,
+		labeledValues: labeledValues{labels: labels},
+		buckets:       buckets,
+		counts:        make(map[string][]uint64),
+		sums:          make(map[string]float64),
+		totals:        make(map[string]uint64),
+	}
+	registerMetric(h)
+	return h
+}
+
+func (h *Histogram) name() string {
+	return h.metricName
+}
+
+// Observe records a single value for these label values.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	counts, ok := h.counts[key]
+	if !ok {
+		h.keys = append(h.keys, key)
+		counts = make([]uint64, len(h.buckets))
+		h.counts[key] = counts
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			counts[i]++
+		}
+	}
+	h.sums[key] += value
+	h.totals[key]++
+}
+
+// Count returns how many values have been observed for these label values.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	key := h.key(labelValues)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.totals[key]
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.metricName, h.help, h.metricName)
+	for _, key := range h.keys {
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName,
+				braces(key, fmt.Sprintf(`le="%s"`, formatFloat(bound))), h.counts[key][i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, braces(key, `le="+Inf"`), h.totals[key])
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, braces(key, ""), formatFloat(h.sums[key]))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, braces(key, ""), h.totals[key])
+	}
+}
@@ -0,0 +1,48 @@
+package util
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	c := NewCounter("test_counter_total", "A counter for testing.", "color")
+	c.Inc("red")
+	c.Add(2, "red")
+	c.Inc("blue")
+	if c.Get("red") != 3 {
+		t.Fatalf("expected 3 red but got %f", c.Get("red"))
+	}
+
+	g := NewGauge("test_gauge", "A gauge for testing.")
+	g.Set(7)
+	g.Set(5)
+
+	h := NewHistogram("test_histogram", "A histogram for testing.", []float64{1, 10})
+	h.Observe(0.5)
+	h.Observe(5)
+	h.Observe(50)
+	if h.Count() != 3 {
+		t.Fatalf("expected 3 observations but got %d", h.Count())
+	}
+
+	buf := new(bytes.Buffer)
+	WriteMetrics(buf)
+	output := buf.String()
+	for _, line := range []string{
+		"# TYPE test_counter_total counter",
+		`test_counter_total{color="red"} 3`,
+		`test_counter_total{color="blue"} 1`,
+		"test_gauge 5",
+		`test_histogram_bucket{le="1"} 1`,
+		`test_histogram_bucket{le="10"} 2`,
+		`test_histogram_bucket{le="+Inf"} 3`,
+		"test_histogram_sum 55.5",
+		"test_histogram_count 3",
+	} {
+		if !strings.Contains(output, line+"\n") {
+			t.Fatalf("expected line %q in output:\n%s", line, output)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package util
+
+import (
+	"sync"
+)
+
+// A SafeCounter keeps a count for each of a set of keys. It is threadsafe.
+type SafeCounter struct {
+	mutex sync.Mutex
+	data  map[string]int
+}
+
+func NewSafeCounter() *SafeCounter {
+	return &SafeCounter{
+		data: make(map[string]int),
+	}
+}
+
+func (c *SafeCounter) Increment(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.data[key] += 1
+}
+
+func (c *SafeCounter) Get(key string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.data[key]
+}
+
+// Items returns a copy of all the counts.
+func (c *SafeCounter) Items() map[string]int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	answer := make(map[string]int)
+	for key, count := range c.data {
+		answer[key] = count
+	}
+	return answer
+}
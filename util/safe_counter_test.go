@@ -0,0 +1,23 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestCounterOps(t *testing.T) {
+	c := NewSafeCounter()
+	c.Increment("foo")
+	c.Increment("foo")
+	c.Increment("bar")
+	if c.Get("foo") != 2 {
+		t.Fatalf("expected 2 foo")
+	}
+	if c.Get("baz") != 0 {
+		t.Fatalf("expected 0 baz")
+	}
+	items := c.Items()
+	c.Increment("bar")
+	if items["bar"] != 1 {
+		t.Fatalf("items should be a copy")
+	}
+}
@@ -11,6 +11,9 @@ import (
 
 const OK = "ok"
 
+// MaxRequestIDLength is the longest request id we accept.
+const MaxRequestIDLength = 64
+
 type SignedMessage struct {
 	message       Message
 	messageString string
@@ -20,6 +23,11 @@ type SignedMessage struct {
 	// Whenever keepalive is true, the SignedMessage has no real content, it's
 	// just a small value used to keep a network connection alive
 	keepalive bool
+
+	// requestID is optionally set by a client so that it can tell which
+	// response goes with which request. It is not covered by the signature.
+	// A keepalive with a request id means there is no response to that request.
+	requestID string
 }
 
 func NewSignedMessage(message Message, kp *KeyPair) *SignedMessage {
@@ -47,7 +55,12 @@ func (sm *SignedMessage) Signature() string {
 	return sm.signature
 }
 
+// Serialize uses the "e" envelope, or the "r" envelope when there is a request id.
 func (sm *SignedMessage) Serialize() string {
+	if sm.requestID != "" {
+		return fmt.Sprintf("r:%s:%s:%s:%s",
+			sm.requestID, sm.signer, sm.signature, sm.messageString)
+	}
 	return fmt.Sprintf("e:%s:%s:%s", sm.signer, sm.signature, sm.messageString)
 }
 
@@ -55,6 +68,41 @@ func (sm *SignedMessage) IsKeepAlive() bool {
 	return sm.keepalive
 }
 
+func (sm *SignedMessage) RequestID() string {
+	return sm.requestID
+}
+
+// WithRequestID returns a copy of this message with the provided request id.
+// An empty id removes the request id.
+func (sm *SignedMessage) WithRequestID(id string) *SignedMessage {
+	if !IsValidRequestID(id) {
+		Logger.Fatalf("invalid request id: %s", id)
+	}
+	answer := *sm
+	answer.requestID = id
+	return &answer
+}
+
+// IsValidRequestID returns whether this string can be used as a request id.
+// Request ids are short strings of letters, numbers, dashes, and underscores.
+// The empty string is valid, and means there is no request id.
+func IsValidRequestID(id string) bool {
+	if len(id) > MaxRequestIDLength {
+		return false
+	}
+	for _, ch := range id {
+		switch {
+		case ch >= 'a' && ch <= 'z':
+		case ch >= 'A' && ch <= 'Z':
+		case ch >= '0' && ch <= '9':
+		case ch == '-' || ch == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // Panics if this message cannot be serialized and deserialized
 func (sm *SignedMessage) CheckSerialization() {
 	serialized := sm.Serialize()
@@ -65,6 +113,22 @@ func (sm *SignedMessage) CheckSerialization() {
 }
 
 func NewSignedMessageFromSerialized(serialized string) (*SignedMessage, error) {
+	return NewLimitedSignedMessageFromSerialized(serialized, DefaultMessageLimits)
+}
+
+// NewLimitedSignedMessageFromSerialized is like NewSignedMessageFromSerialized,
+// but it rejects messages that go over the provided limits.
+func NewLimitedSignedMessageFromSerialized(
+	serialized string, limits *MessageLimits) (*SignedMessage, error) {
+	requestID := ""
+	if strings.HasPrefix(serialized, "r:") {
+		parts := strings.SplitN(serialized, ":", 3)
+		if len(parts) != 3 || parts[1] == "" || !IsValidRequestID(parts[1]) {
+			return nil, errors.New("invalid request id")
+		}
+		requestID = parts[1]
+		serialized = "e:" + parts[2]
+	}
 	parts := strings.SplitN(serialized, ":", 4)
 	if len(parts) != 4 {
 		return nil, errors.New("could not find 4 parts")
@@ -81,9 +145,9 @@ func NewSignedMessageFromSerialized(serialized string) (*SignedMessage, error) {
 		Logger.Printf("invalid signature on signed message: %s", serialized)
 		return nil, errors.New("signature failed verification")
 	}
-	m, err := DecodeMessage(ms)
+	m, err := DecodeLimitedMessage(ms, limits)
 	if err != nil {
-		Logger.Printf("DecodeMessage failed reading SignedMessage: %s", serialized)
+		Logger.Printf("DecodeMessage failed reading SignedMessage: %s", Shorten(serialized))
 		return nil, err
 	}
 	return &SignedMessage{
@@ -91,6 +155,7 @@ func NewSignedMessageFromSerialized(serialized string) (*SignedMessage, error) {
 		messageString: ms,
 		signer:        signer,
 		signature:     signature,
+		requestID:     requestID,
 	}, nil
 }
 
@@ -103,7 +168,9 @@ func (sm *SignedMessage) Write(w io.Writer) {
 		panic("cannot write nil signed message")
 	}
 	var data string
-	if sm.keepalive {
+	if sm.keepalive && sm.requestID != "" {
+		data = OK + ":" + sm.requestID + "\n"
+	} else if sm.keepalive {
 		data = OK + "\n"
 	} else {
 		data = sm.Serialize() + "\n"
@@ -115,11 +182,24 @@ func (sm *SignedMessage) Write(w io.Writer) {
 // Specifically, a line with just "ok" indicates no message, but also no error.
 // The caller is responsible for setting any deadlines.
 func ReadSignedMessage(r *bufio.Reader) (*SignedMessage, error) {
-	data, err := r.ReadString('\n')
+	return ReadLimitedSignedMessage(r, DefaultMessageLimits)
+}
+
+// ReadLimitedSignedMessage is like ReadSignedMessage, but it returns a
+// LimitError as soon as the message goes over the provided limits.
+// Every rejection is counted in LimitRejections.
+func ReadLimitedSignedMessage(r *bufio.Reader, limits *MessageLimits) (*SignedMessage, error) {
+	sm, err := readLimitedSignedMessage(r, limits)
+	if le, ok := err.(*LimitError); ok {
+		LimitRejections.Increment(le.Kind)
+		limitRejectionsMetric.Inc(le.Kind)
+	}
+	return sm, err
+}
+
+func readLimitedSignedMessage(r *bufio.Reader, limits *MessageLimits) (*SignedMessage, error) {
+	data, err := readLine(r, limits.MaxLineSize)
 	if err != nil {
-		if err == io.EOF {
-			return nil, fmt.Errorf("no endline while reading: [%s]", data)
-		}
 		return nil, err
 	}
 
@@ -128,6 +208,37 @@ func ReadSignedMessage(r *bufio.Reader) (*SignedMessage, error) {
 	if serialized == OK {
 		return &SignedMessage{keepalive: true}, nil
 	}
+	if strings.HasPrefix(serialized, OK+":") {
+		id := strings.TrimPrefix(serialized, OK+":")
+		if id == "" || !IsValidRequestID(id) {
+			return nil, errors.New("invalid request id")
+		}
+		return &SignedMessage{keepalive: true, requestID: id}, nil
+	}
 
-	return NewSignedMessageFromSerialized(serialized)
+	return NewLimitedSignedMessageFromSerialized(serialized, limits)
+}
+
+// readLine reads through the next newline, but gives up without buffering the
+// rest once the line is longer than maxSize.
+// A maxSize of zero means the line length is not limited.
+func readLine(r *bufio.Reader, maxSize int) (string, error) {
+	line := []byte{}
+	for {
+		chunk, err := r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if maxSize > 0 && len(line) > maxSize+1 {
+			return "", &LimitError{Kind: "line", Limit: maxSize}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			return "", fmt.Errorf("no endline while reading: [%s]", Shorten(string(line)))
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(line), nil
+	}
 }
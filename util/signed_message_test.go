@@ -1,6 +1,7 @@
 package util
 
 import (
+	"bufio"
 	"bytes"
 	"strings"
 	"testing"
@@ -48,3 +49,77 @@ func TestSignedMessageWithPercents(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestSignedMessageRequestID(t *testing.T) {
+	kp := NewKeyPairFromSecretPhrase("foo")
+	sm := NewSignedMessage(&TestingMessage{Number: 3}, kp).WithRequestID("abc-1")
+	buf := new(bytes.Buffer)
+	sm.Write(buf)
+	KeepAlive().WithRequestID("abc-2").Write(buf)
+	KeepAlive().Write(buf)
+
+	reader := bufio.NewReader(buf)
+	sm2, err := ReadSignedMessage(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sm2.RequestID() != "abc-1" || sm2.Message().(*TestingMessage).Number != 3 {
+		t.Fatalf("bad message: %+v", sm2)
+	}
+	ka, err := ReadSignedMessage(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ka.IsKeepAlive() || ka.RequestID() != "abc-2" {
+		t.Fatalf("bad keepalive: %+v", ka)
+	}
+	ka, err = ReadSignedMessage(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ka.IsKeepAlive() || ka.RequestID() != "" {
+		t.Fatalf("bad keepalive: %+v", ka)
+	}
+
+	_, err = NewSignedMessageFromSerialized("r:bad:id:" + sm.Serialize()[len("r:abc-1:"):])
+	if err == nil {
+		t.Fatalf("a request id with a colon should not parse")
+	}
+}
+
+func TestReadSignedMessageLineLimit(t *testing.T) {
+	m := &TestingMessage{Text: strings.Repeat("x", 1000)}
+	kp := NewKeyPairFromSecretPhrase("foo")
+	buf := new(bytes.Buffer)
+	NewSignedMessage(m, kp).Write(buf)
+	limits := &MessageLimits{MaxLineSize: 100}
+	_, err := ReadLimitedSignedMessage(bufio.NewReader(buf), limits)
+	le, ok := err.(*LimitError)
+	if !ok || le.Kind != "line" {
+		t.Fatalf("expected a line limit error but got %v", err)
+	}
+}
+
+func TestSignedMessageDepthLimit(t *testing.T) {
+	kp := NewKeyPairFromSecretPhrase("foo")
+	ms := `{"message":{"text":` + strings.Repeat("[", 100) + strings.Repeat("]", 100) +
+		`},"type":"Testing"}`
+	serialized := "e:" + kp.PublicKey().String() + ":" + kp.Sign(ms) + ":" + ms
+	_, err := NewSignedMessageFromSerialized(serialized)
+	le, ok := err.(*LimitError)
+	if !ok || le.Kind != "depth" {
+		t.Fatalf("expected a depth limit error but got %v", err)
+	}
+}
+
+// The fuzzed input is the message part, signed so that decoding gets exercised
+func FuzzNewSignedMessageFromSerialized(f *testing.F) {
+	kp := NewKeyPairFromSecretPhrase("foo")
+	f.Add(EncodeMessage(&TestingMessage{Number: 4}))
+	f.Add(EncodeMessage(&TestingMessage{Text: "bar"}))
+	f.Add(`{"message":null,"type":"Testing"}`)
+	f.Fuzz(func(t *testing.T, ms string) {
+		serialized := "e:" + kp.PublicKey().String() + ":" + kp.Sign(ms) + ":" + ms
+		NewSignedMessageFromSerialized(serialized)
+	})
+}